@@ -0,0 +1,867 @@
+/*
+Copyright © 2021 SignorMercurio
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package enc
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	ageIntro       = "age-encryption.org/v1"
+	ageArmorType   = "AGE ENCRYPTED FILE"
+	ageColumns     = 64
+	ageMaxWorkFact = 22
+	bech32Charset  = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+)
+
+var (
+	ageRecipients []string
+	ageIdentities []string
+	ageArmor      bool
+	ageWorkFactor int
+)
+
+// ageStanza is a recipient stanza in the header of an age file
+type ageStanza struct {
+	Type string
+	Args []string
+	Body []byte
+}
+
+// ageRecipient wraps the file key for one recipient
+type ageRecipient interface {
+	Wrap(fileKey []byte) (*ageStanza, error)
+}
+
+// ageIdentity unwraps the file key from a stanza, returning nil if the stanza is not for it
+type ageIdentity interface {
+	Unwrap(s *ageStanza) ([]byte, error)
+}
+
+// NewAgeCmd represents the age command
+func NewAgeCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "age",
+		Short: "age file encryption / decryption",
+		Long: `age file encryption / decryption
+Files are in the age v1 format, compatible with the reference age tool.
+Recipients are X25519 recipients (age1...), SSH ed25519 / RSA public keys,
+or files of them, one per line. Identities are files of X25519 identities (AGE-SECRET-KEY-1...),
+or SSH / PEM ed25519 / RSA private keys. Use akg -a age to generate an X25519 identity.
+Input is streamed, so it must not be the same file as the output
+Example:
+	att enc -i in.txt -o out.age age -e -r age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p
+	att enc -i in.txt -o out.age age -e -r ~/.ssh/id_ed25519.pub -r recipients.txt -a
+	att enc -i in.txt -o out.age age -e --pass secret
+	att enc -i out.age age -d --identity key.txt
+	att enc -i out.age age -d --pass secret`,
+		Annotations: map[string]string{noInput: ""},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var in io.Reader = os.Stdin
+			if inputFile != "" {
+				f, err := os.Open(inputFile)
+				if err != nil {
+					return errors.Wrap(err, "open input file")
+				}
+				defer f.Close()
+				in = f
+			}
+
+			if enc {
+				return ageEncrypt(in, output)
+			} else if dec {
+				return ageDecrypt(in, output)
+			} else {
+				NoActionSpecified()
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVarP(&enc, "encrypt", "e", false, "age encryption")
+	cmd.Flags().BoolVarP(&dec, "decrypt", "d", false, "age decryption")
+	cmd.Flags().StringArrayVarP(&ageRecipients, "recipient", "r", nil, "Recipient or file of recipients, can be repeated")
+	cmd.Flags().StringArrayVar(&ageIdentities, "identity", nil, "File of identities or private key to decrypt with, can be repeated")
+	cmd.Flags().StringVar(&passphrase, "pass", "", "Passphrase to encrypt / decrypt with scrypt, or of the SSH private key")
+	cmd.Flags().IntVarP(&ageWorkFactor, "work-factor", "w", 18, "scrypt work factor (log2 of N) for passphrase encryption")
+	cmd.Flags().BoolVarP(&ageArmor, "armor", "a", false, "Encrypt to a PEM-armored file")
+
+	return cmd
+}
+
+// ageEncrypt encrypts [in] for the recipients or with the passphrase, writing the age file to [out]
+func ageEncrypt(in io.Reader, out io.Writer) error {
+	var recipients []ageRecipient
+	for _, r := range ageRecipients {
+		parsed, err := parseAgeRecipients(r)
+		if err != nil {
+			return err
+		}
+		recipients = append(recipients, parsed...)
+	}
+	if len(recipients) == 0 {
+		if passphrase == "" {
+			return errors.New("find any recipient. Please specify either -r or --pass")
+		}
+		if ageWorkFactor <= 0 || ageWorkFactor > ageMaxWorkFact {
+			return errors.New("validate work factor: it should be between 1 and " + strconv.Itoa(ageMaxWorkFact))
+		}
+		recipients = append(recipients, &scryptRecipient{password: []byte(passphrase), logN: ageWorkFactor})
+	} else if passphrase != "" {
+		return errors.New("validate recipients: a passphrase can't be combined with other recipients")
+	}
+
+	fileKey := genNonce(16)
+	var header bytes.Buffer
+	header.WriteString(ageIntro + "\n")
+	for _, r := range recipients {
+		s, err := r.Wrap(fileKey)
+		if err != nil {
+			return err
+		}
+		writeAgeStanza(&header, s)
+	}
+	header.WriteString("---")
+	header.WriteString(" " + base64.RawStdEncoding.EncodeToString(ageHeaderMAC(fileKey, header.Bytes())) + "\n")
+
+	plain := out
+	var armored bytes.Buffer
+	if ageArmor {
+		plain = &armored
+	}
+	nonce := genNonce(16)
+	if _, err := plain.Write(append(header.Bytes(), nonce...)); err != nil {
+		return errors.Wrap(err, "write header")
+	}
+	aead, _ := chacha20poly1305.New(ageHKDF(fileKey, nonce, "payload"))
+	if err := sealChunks(bufio.NewReader(in), plain, aead, nil); err != nil {
+		return err
+	}
+
+	if ageArmor {
+		if err := pem.Encode(out, &pem.Block{Type: ageArmorType, Bytes: armored.Bytes()}); err != nil {
+			return errors.Wrap(err, "write output")
+		}
+	}
+	return nil
+}
+
+// ageDecrypt decrypts an age file from [in] with the identities or the passphrase, writing the plaintext to [out]
+func ageDecrypt(in io.Reader, out io.Writer) error {
+	var identities []ageIdentity
+	for _, path := range ageIdentities {
+		parsed, err := parseAgeIdentities(path)
+		if err != nil {
+			return err
+		}
+		identities = append(identities, parsed...)
+	}
+	if len(ageIdentities) == 0 && passphrase != "" {
+		identities = append(identities, &scryptIdentity{password: []byte(passphrase)})
+	}
+	if len(identities) == 0 {
+		return errors.New("find any identity. Please specify either --identity or --pass")
+	}
+
+	br := bufio.NewReader(in)
+	if prefix, _ := br.Peek(len("-----BEGIN " + ageArmorType)); string(prefix) == "-----BEGIN "+ageArmorType {
+		data, err := io.ReadAll(br)
+		if err != nil {
+			return errors.Wrap(err, "read input")
+		}
+		block, _ := pem.Decode(data)
+		if block == nil || block.Type != ageArmorType {
+			return errors.New("decode armor")
+		}
+		br = bufio.NewReader(bytes.NewReader(block.Bytes))
+	}
+
+	stanzas, headerNoMAC, mac, err := readAgeHeader(br)
+	if err != nil {
+		return err
+	}
+
+	var fileKey []byte
+	for _, s := range stanzas {
+		if s.Type == "scrypt" && len(stanzas) != 1 {
+			return errors.New("validate header: scrypt stanza must be alone")
+		}
+	}
+	for _, id := range identities {
+		for _, s := range stanzas {
+			if fileKey, err = id.Unwrap(s); err != nil {
+				return err
+			}
+			if fileKey != nil {
+				break
+			}
+		}
+		if fileKey != nil {
+			break
+		}
+	}
+	if fileKey == nil {
+		return errors.New("find a recipient matching the identities")
+	}
+	if !hmac.Equal(ageHeaderMAC(fileKey, headerNoMAC), mac) {
+		return errors.New("verify header MAC")
+	}
+
+	nonce := make([]byte, 16)
+	if _, err := io.ReadFull(br, nonce); err != nil {
+		return errors.Wrap(err, "read payload nonce")
+	}
+	aead, _ := chacha20poly1305.New(ageHKDF(fileKey, nonce, "payload"))
+	return openChunks(br, out, aead, nil)
+}
+
+// writeAgeStanza writes a stanza with its body in base64 lines of 64 columns
+func writeAgeStanza(w *bytes.Buffer, s *ageStanza) {
+	w.WriteString("-> " + strings.Join(append([]string{s.Type}, s.Args...), " ") + "\n")
+	body := base64.RawStdEncoding.EncodeToString(s.Body)
+	// the body always ends with a line shorter than 64 columns, which may be empty
+	for {
+		n := len(body)
+		if n > ageColumns {
+			n = ageColumns
+		}
+		w.WriteString(body[:n] + "\n")
+		if n < ageColumns {
+			return
+		}
+		body = body[n:]
+	}
+}
+
+// readAgeHeader reads the header of an age file, returning the stanzas,
+// the header up to the MAC, and the MAC
+func readAgeHeader(br *bufio.Reader) ([]*ageStanza, []byte, []byte, error) {
+	var raw bytes.Buffer
+	readLine := func() (string, error) {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return "", errors.New("read header")
+		}
+		raw.WriteString(line)
+		return strings.TrimSuffix(line, "\n"), nil
+	}
+
+	intro, err := readLine()
+	if err != nil || intro != ageIntro {
+		return nil, nil, nil, errors.New("recognize age file")
+	}
+
+	var stanzas []*ageStanza
+	for {
+		line, err := readLine()
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		if strings.HasPrefix(line, "--- ") {
+			mac, err := base64.RawStdEncoding.DecodeString(line[4:])
+			if err != nil {
+				return nil, nil, nil, errors.Wrap(err, "decode header MAC")
+			}
+			headerNoMAC := raw.Bytes()[:raw.Len()-len(line)-1+3]
+			return stanzas, headerNoMAC, mac, nil
+		}
+		if !strings.HasPrefix(line, "-> ") {
+			return nil, nil, nil, errors.New("parse header line " + line)
+		}
+		fields := strings.Split(line[3:], " ")
+		s := &ageStanza{Type: fields[0], Args: fields[1:]}
+
+		var body strings.Builder
+		for {
+			bodyLine, err := readLine()
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			if len(bodyLine) > ageColumns {
+				return nil, nil, nil, errors.New("parse stanza body")
+			}
+			body.WriteString(bodyLine)
+			if len(bodyLine) < ageColumns {
+				break
+			}
+		}
+		if s.Body, err = base64.RawStdEncoding.Strict().DecodeString(body.String()); err != nil {
+			return nil, nil, nil, errors.Wrap(err, "decode stanza body")
+		}
+		stanzas = append(stanzas, s)
+	}
+}
+
+// ageHKDF derives a 32-byte key with HKDF-SHA256
+func ageHKDF(secret, salt []byte, info string) []byte {
+	key := make([]byte, chacha20poly1305.KeySize)
+	io.ReadFull(hkdf.New(sha256.New, secret, salt, []byte(info)), key)
+	return key
+}
+
+// ageHeaderMAC computes the MAC of the header up to and including "---"
+func ageHeaderMAC(fileKey, header []byte) []byte {
+	h := hmac.New(sha256.New, ageHKDF(fileKey, nil, "header"))
+	h.Write(header)
+	return h.Sum(nil)
+}
+
+// ageWrapKey encrypts the file key with a zero nonce
+func ageWrapKey(key, fileKey []byte) []byte {
+	aead, _ := chacha20poly1305.New(key)
+	return aead.Seal(nil, make([]byte, aead.NonceSize()), fileKey, nil)
+}
+
+// ageUnwrapKey decrypts the file key, returning nil if it is not for [key]
+func ageUnwrapKey(key, body []byte) []byte {
+	aead, _ := chacha20poly1305.New(key)
+	fileKey, err := aead.Open(nil, make([]byte, aead.NonceSize()), body, nil)
+	if err != nil {
+		return nil
+	}
+	return fileKey
+}
+
+// parseAgeRecipients parses a recipient, or reads all recipients from a file
+func parseAgeRecipients(s string) ([]ageRecipient, error) {
+	if strings.HasPrefix(s, "age1") || strings.HasPrefix(s, "ssh-") {
+		r, err := parseAgeRecipient(s)
+		if err != nil {
+			return nil, err
+		}
+		return []ageRecipient{r}, nil
+	}
+
+	data, err := os.ReadFile(s)
+	if err != nil {
+		return nil, errors.Wrap(err, "read recipients file")
+	}
+	trimmed := strings.TrimSpace(string(data))
+	if !strings.HasPrefix(trimmed, "age1") && !strings.HasPrefix(trimmed, "ssh-") && !strings.HasPrefix(trimmed, "#") {
+		// a single public key in any format supported by loadKey
+		k, err := loadKey(data)
+		if err != nil {
+			return nil, err
+		}
+		r, err := newSSHRecipient(publicKey(k))
+		if err != nil {
+			return nil, err
+		}
+		return []ageRecipient{r}, nil
+	}
+
+	var recipients []ageRecipient
+	for _, line := range strings.Split(trimmed, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		r, err := parseAgeRecipient(line)
+		if err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, r)
+	}
+	return recipients, nil
+}
+
+// parseAgeRecipient parses an X25519 recipient or an SSH public key
+func parseAgeRecipient(s string) (ageRecipient, error) {
+	if strings.HasPrefix(s, "ssh-") {
+		sshPubKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(s))
+		if err != nil {
+			return nil, errors.Wrap(err, "parse OpenSSH public key")
+		}
+		if _, ok := sshPubKey.(*ssh.Certificate); ok {
+			return nil, errors.New("use SSH certificate as recipient")
+		}
+		cryptoPubKey, ok := sshPubKey.(ssh.CryptoPublicKey)
+		if !ok {
+			return nil, errors.New("use SSH " + sshPubKey.Type() + " key as recipient")
+		}
+		return newSSHRecipient(cryptoPubKey.CryptoPublicKey())
+	}
+
+	hrp, data, err := bech32Decode(s)
+	if err != nil {
+		return nil, err
+	}
+	if hrp != "age" || len(data) != curve25519.PointSize {
+		return nil, errors.New("parse recipient " + s)
+	}
+	return &x25519Recipient{pub: data}, nil
+}
+
+// newSSHRecipient creates a recipient of an SSH ed25519 / RSA public key
+func newSSHRecipient(pub interface{}) (ageRecipient, error) {
+	sshPubKey, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		return nil, errors.Wrap(err, "convert to SSH public key")
+	}
+	switch pub := pub.(type) {
+	case ed25519.PublicKey:
+		x25519Pub, err := ed25519PubToX25519(pub)
+		if err != nil {
+			return nil, err
+		}
+		return &sshEd25519Recipient{sshKey: sshPubKey.Marshal(), pub: x25519Pub}, nil
+	case *rsa.PublicKey:
+		return &sshRSARecipient{sshKey: sshPubKey.Marshal(), pub: pub}, nil
+	}
+	return nil, errors.New("use " + sshPubKey.Type() + " key as recipient")
+}
+
+// parseAgeIdentities reads X25519 identities or an SSH / PEM private key from a file
+func parseAgeIdentities(path string) ([]ageIdentity, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "read identity file")
+	}
+
+	if !bytes.Contains(data, []byte("AGE-SECRET-KEY-1")) {
+		k, err := loadKey(data)
+		if err != nil {
+			return nil, err
+		}
+		id, err := newSSHIdentity(k)
+		if err != nil {
+			return nil, err
+		}
+		return []ageIdentity{id}, nil
+	}
+
+	var identities []ageIdentity
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		hrp, key, err := bech32Decode(line)
+		if err != nil {
+			return nil, err
+		}
+		if hrp != "age-secret-key-" || len(key) != curve25519.ScalarSize {
+			return nil, errors.New("parse identity in " + path)
+		}
+		identities = append(identities, &x25519Identity{priv: key})
+	}
+	return identities, nil
+}
+
+// newSSHIdentity creates an identity of an SSH ed25519 / RSA private key
+func newSSHIdentity(k interface{}) (ageIdentity, error) {
+	if !isPrivKey(k) {
+		return nil, errors.New("use public key as identity")
+	}
+	sshPubKey, err := ssh.NewPublicKey(publicKey(k))
+	if err != nil {
+		return nil, errors.Wrap(err, "convert to SSH public key")
+	}
+	switch k := k.(type) {
+	case ed25519.PrivateKey:
+		h := sha512.Sum512(k.Seed())
+		x25519Pub, err := ed25519PubToX25519(k.Public().(ed25519.PublicKey))
+		if err != nil {
+			return nil, err
+		}
+		return &sshEd25519Identity{
+			sshKey: sshPubKey.Marshal(),
+			priv:   h[:curve25519.ScalarSize],
+			pub:    x25519Pub,
+		}, nil
+	case *rsa.PrivateKey:
+		return &sshRSAIdentity{sshKey: sshPubKey.Marshal(), priv: k}, nil
+	}
+	return nil, errors.New("use " + sshPubKey.Type() + " key as identity")
+}
+
+// marshalAgeIdentity formats an X25519 private key as an age identity file
+func marshalAgeIdentity(k x25519PrivateKey) string {
+	return fmt.Sprintf("# created: %s\n# public key: %s\n%s\n",
+		time.Now().Format(time.RFC3339),
+		bech32Encode("age", k.Public()),
+		strings.ToUpper(bech32Encode("age-secret-key-", k)),
+	)
+}
+
+// x25519Recipient is an X25519 recipient
+type x25519Recipient struct {
+	pub x25519PublicKey
+}
+
+func (r *x25519Recipient) Wrap(fileKey []byte) (*ageStanza, error) {
+	ephemeral := genX25519Key()
+	share := ephemeral.Public()
+	secret, err := x25519(ephemeral, r.pub)
+	if err != nil {
+		return nil, err
+	}
+
+	salt := append(append([]byte{}, share...), r.pub...)
+	key := ageHKDF(secret, salt, ageIntro+"/X25519")
+	return &ageStanza{
+		Type: "X25519",
+		Args: []string{base64.RawStdEncoding.EncodeToString(share)},
+		Body: ageWrapKey(key, fileKey),
+	}, nil
+}
+
+// x25519Identity is an X25519 identity
+type x25519Identity struct {
+	priv x25519PrivateKey
+}
+
+func (id *x25519Identity) Unwrap(s *ageStanza) ([]byte, error) {
+	if s.Type != "X25519" {
+		return nil, nil
+	}
+	if len(s.Args) != 1 {
+		return nil, errors.New("parse X25519 stanza")
+	}
+	share, err := base64.RawStdEncoding.Strict().DecodeString(s.Args[0])
+	if err != nil || len(share) != curve25519.PointSize {
+		return nil, errors.New("parse X25519 stanza")
+	}
+	secret, err := x25519(id.priv, share)
+	if err != nil {
+		return nil, err
+	}
+
+	salt := append(append([]byte{}, share...), id.priv.Public()...)
+	return ageUnwrapKey(ageHKDF(secret, salt, ageIntro+"/X25519"), s.Body), nil
+}
+
+// scryptRecipient is a passphrase recipient
+type scryptRecipient struct {
+	password []byte
+	logN     int
+}
+
+func (r *scryptRecipient) Wrap(fileKey []byte) (*ageStanza, error) {
+	salt := genNonce(16)
+	key, err := scrypt.Key(r.password, append([]byte(ageIntro+"/scrypt"), salt...), 1<<r.logN, 8, 1, chacha20poly1305.KeySize)
+	if err != nil {
+		return nil, errors.Wrap(err, "derive key with scrypt")
+	}
+	return &ageStanza{
+		Type: "scrypt",
+		Args: []string{base64.RawStdEncoding.EncodeToString(salt), strconv.Itoa(r.logN)},
+		Body: ageWrapKey(key, fileKey),
+	}, nil
+}
+
+// scryptIdentity is a passphrase identity
+type scryptIdentity struct {
+	password []byte
+}
+
+func (id *scryptIdentity) Unwrap(s *ageStanza) ([]byte, error) {
+	if s.Type != "scrypt" {
+		return nil, nil
+	}
+	if len(s.Args) != 2 {
+		return nil, errors.New("parse scrypt stanza")
+	}
+	salt, err := base64.RawStdEncoding.Strict().DecodeString(s.Args[0])
+	if err != nil || len(salt) != 16 {
+		return nil, errors.New("parse scrypt stanza")
+	}
+	logN, err := strconv.Atoi(s.Args[1])
+	if err != nil || logN <= 0 || logN > ageMaxWorkFact {
+		return nil, errors.New("validate scrypt work factor " + s.Args[1])
+	}
+
+	key, err := scrypt.Key(id.password, append([]byte(ageIntro+"/scrypt"), salt...), 1<<logN, 8, 1, chacha20poly1305.KeySize)
+	if err != nil {
+		return nil, errors.Wrap(err, "derive key with scrypt")
+	}
+	fileKey := ageUnwrapKey(key, s.Body)
+	if fileKey == nil {
+		return nil, errors.New("decrypt with the passphrase")
+	}
+	return fileKey, nil
+}
+
+// sshTag returns the first 4 bytes of the SHA-256 of an SSH public key
+func sshTag(sshKey []byte) string {
+	digest := sha256.Sum256(sshKey)
+	return base64.RawStdEncoding.EncodeToString(digest[:4])
+}
+
+// sshEd25519Recipient is an SSH ed25519 recipient
+type sshEd25519Recipient struct {
+	sshKey []byte
+	pub    []byte
+}
+
+func (r *sshEd25519Recipient) Wrap(fileKey []byte) (*ageStanza, error) {
+	ephemeral := genX25519Key()
+	share := ephemeral.Public()
+	secret, err := x25519(ephemeral, r.pub)
+	if err != nil {
+		return nil, err
+	}
+	tweak := ageHKDF(nil, r.sshKey, ageIntro+"/ssh-ed25519")
+	if secret, err = x25519(tweak, secret); err != nil {
+		return nil, err
+	}
+
+	salt := append(append([]byte{}, share...), r.pub...)
+	key := ageHKDF(secret, salt, ageIntro+"/ssh-ed25519")
+	return &ageStanza{
+		Type: "ssh-ed25519",
+		Args: []string{sshTag(r.sshKey), base64.RawStdEncoding.EncodeToString(share)},
+		Body: ageWrapKey(key, fileKey),
+	}, nil
+}
+
+// sshEd25519Identity is an SSH ed25519 identity
+type sshEd25519Identity struct {
+	sshKey []byte
+	priv   []byte
+	pub    []byte
+}
+
+func (id *sshEd25519Identity) Unwrap(s *ageStanza) ([]byte, error) {
+	if s.Type != "ssh-ed25519" {
+		return nil, nil
+	}
+	if len(s.Args) != 2 {
+		return nil, errors.New("parse ssh-ed25519 stanza")
+	}
+	if s.Args[0] != sshTag(id.sshKey) {
+		return nil, nil
+	}
+	share, err := base64.RawStdEncoding.Strict().DecodeString(s.Args[1])
+	if err != nil || len(share) != curve25519.PointSize {
+		return nil, errors.New("parse ssh-ed25519 stanza")
+	}
+
+	secret, err := x25519(id.priv, share)
+	if err != nil {
+		return nil, err
+	}
+	tweak := ageHKDF(nil, id.sshKey, ageIntro+"/ssh-ed25519")
+	if secret, err = x25519(tweak, secret); err != nil {
+		return nil, err
+	}
+
+	salt := append(append([]byte{}, share...), id.pub...)
+	return ageUnwrapKey(ageHKDF(secret, salt, ageIntro+"/ssh-ed25519"), s.Body), nil
+}
+
+// sshRSARecipient is an SSH RSA recipient
+type sshRSARecipient struct {
+	sshKey []byte
+	pub    *rsa.PublicKey
+}
+
+func (r *sshRSARecipient) Wrap(fileKey []byte) (*ageStanza, error) {
+	wrapped, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, r.pub, fileKey, []byte(ageIntro+"/ssh-rsa"))
+	if err != nil {
+		return nil, errors.Wrap(err, "wrap file key")
+	}
+	return &ageStanza{Type: "ssh-rsa", Args: []string{sshTag(r.sshKey)}, Body: wrapped}, nil
+}
+
+// sshRSAIdentity is an SSH RSA identity
+type sshRSAIdentity struct {
+	sshKey []byte
+	priv   *rsa.PrivateKey
+}
+
+func (id *sshRSAIdentity) Unwrap(s *ageStanza) ([]byte, error) {
+	if s.Type != "ssh-rsa" {
+		return nil, nil
+	}
+	if len(s.Args) != 1 {
+		return nil, errors.New("parse ssh-rsa stanza")
+	}
+	if s.Args[0] != sshTag(id.sshKey) {
+		return nil, nil
+	}
+
+	fileKey, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, id.priv, s.Body, []byte(ageIntro+"/ssh-rsa"))
+	if err != nil {
+		return nil, errors.Wrap(err, "unwrap file key")
+	}
+	return fileKey, nil
+}
+
+// ed25519PubToX25519 converts an ed25519 public key to its birationally equivalent
+// X25519 public key: u = (1 + y) / (1 - y)
+func ed25519PubToX25519(pub ed25519.PublicKey) ([]byte, error) {
+	p := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 255), big.NewInt(19))
+
+	le := append([]byte{}, pub...)
+	le[31] &= 0x7f
+	y := new(big.Int).SetBytes(reverseBytes(le))
+
+	one := big.NewInt(1)
+	num := new(big.Int).Add(one, y)
+	den := new(big.Int).Sub(one, y)
+	den.Mod(den, p)
+	inv := new(big.Int).ModInverse(den, p)
+	if inv == nil {
+		// y = 1 is the identity point, a low-order point
+		return nil, errors.New("convert ed25519 key of low order to X25519")
+	}
+	u := num.Mul(num, inv)
+	u.Mod(u, p)
+
+	return reverseBytes(u.FillBytes(make([]byte, curve25519.PointSize))), nil
+}
+
+// reverseBytes returns [b] in reverse order
+func reverseBytes(b []byte) []byte {
+	r := make([]byte, len(b))
+	for i := range b {
+		r[len(b)-1-i] = b[i]
+	}
+	return r
+}
+
+// bech32Polymod computes the BCH checksum of Bech32
+func bech32Polymod(values []byte) uint32 {
+	gen := []uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (top>>i)&1 == 1 {
+				chk ^= gen[i]
+			}
+		}
+	}
+	return chk
+}
+
+// bech32HRPExpand expands the human-readable part for the checksum
+func bech32HRPExpand(hrp string) []byte {
+	expanded := make([]byte, 0, len(hrp)*2+1)
+	for i := 0; i < len(hrp); i++ {
+		expanded = append(expanded, hrp[i]>>5)
+	}
+	expanded = append(expanded, 0)
+	for i := 0; i < len(hrp); i++ {
+		expanded = append(expanded, hrp[i]&31)
+	}
+	return expanded
+}
+
+// convertBits regroups [data] from [from]-bit groups to [to]-bit groups
+func convertBits(data []byte, from, to uint, pad bool) ([]byte, error) {
+	var acc uint32
+	var bits uint
+	var result []byte
+	maxv := uint32(1)<<to - 1
+	for _, b := range data {
+		if uint32(b)>>from != 0 {
+			return nil, errors.New("convert bits")
+		}
+		acc = acc<<from | uint32(b)
+		bits += from
+		for bits >= to {
+			bits -= to
+			result = append(result, byte(acc>>bits&maxv))
+		}
+	}
+	if pad {
+		if bits > 0 {
+			result = append(result, byte(acc<<(to-bits)&maxv))
+		}
+	} else if bits >= from || acc<<(to-bits)&maxv != 0 {
+		return nil, errors.New("convert bits: invalid padding")
+	}
+	return result, nil
+}
+
+// bech32Encode encodes [data] in Bech32 with the human-readable part [hrp]
+func bech32Encode(hrp string, data []byte) string {
+	values, _ := convertBits(data, 8, 5, true)
+	checksumInput := append(append(bech32HRPExpand(hrp), values...), 0, 0, 0, 0, 0, 0)
+	polymod := bech32Polymod(checksumInput) ^ 1
+
+	var b strings.Builder
+	b.WriteString(hrp + "1")
+	for _, v := range values {
+		b.WriteByte(bech32Charset[v])
+	}
+	for i := 0; i < 6; i++ {
+		b.WriteByte(bech32Charset[polymod>>(5*(5-i))&31])
+	}
+	return b.String()
+}
+
+// bech32Decode decodes a Bech32 string without the 90-character limit, as age does
+func bech32Decode(s string) (string, []byte, error) {
+	if strings.ToLower(s) != s && strings.ToUpper(s) != s {
+		return "", nil, errors.New("decode Bech32: mixed case")
+	}
+	s = strings.ToLower(s)
+	pos := strings.LastIndex(s, "1")
+	if pos < 1 || pos+7 > len(s) {
+		return "", nil, errors.New("decode Bech32: invalid separator position")
+	}
+
+	hrp := s[:pos]
+	values := make([]byte, 0, len(s)-pos-1)
+	for i := pos + 1; i < len(s); i++ {
+		v := strings.IndexByte(bech32Charset, s[i])
+		if v < 0 {
+			return "", nil, errors.New("decode Bech32: invalid character " + string(s[i]))
+		}
+		values = append(values, byte(v))
+	}
+	if bech32Polymod(append(bech32HRPExpand(hrp), values...)) != 1 {
+		return "", nil, errors.New("decode Bech32: invalid checksum")
+	}
+
+	data, err := convertBits(values[:len(values)-6], 5, 8, false)
+	if err != nil {
+		return "", nil, errors.Wrap(err, "decode Bech32")
+	}
+	return hrp, data, nil
+}
+
+func init() {
+	encCmd.AddCommand(NewAgeCmd())
+}
@@ -17,10 +17,10 @@ package enc
 
 import (
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
-	"crypto/x509"
 	"encoding/pem"
 	"os"
 
@@ -42,8 +42,13 @@ func NewAkgCmd() *cobra.Command {
 		Short: "Asymmetric encryption key generation",
 		Long: `Asymmetric encryption key generation
 Example:
-	att enc -o pubkey.pub akg -p priv.key -b 4096`,
+	att enc -o pubkey.pub akg -p priv.key -b 4096
+	att enc akg -a age --priv key.txt --pub recipient.txt`,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if alg == "age" {
+				return exportAgeKey()
+			}
+
 			priv, pub := genKeyPair()
 			err := exportPrivKey(priv)
 			if err != nil {
@@ -57,7 +62,7 @@ Example:
 		},
 	}
 	cmd.Flags().IntVarP(&bits, "bits", "b", 2048, "Key bits, or Curve name in ECDSA: 224 / 256 / 384 / 521")
-	cmd.Flags().StringVarP(&alg, "algorithm", "a", "rsa", "Encryption algorithm to use: rsa / ecdsa")
+	cmd.Flags().StringVarP(&alg, "algorithm", "a", "rsa", "Encryption algorithm to use: rsa / ecdsa / ed25519 / x25519 / age")
 	cmd.Flags().StringVar(&privKeyPath, "priv", "./priv.pem", "Path to store private key")
 	cmd.Flags().StringVar(&pubKeyPath, "pub", "./pub.pem", "Path to store public key")
 
@@ -84,6 +89,12 @@ func genKeyPair() (interface{}, interface{}) {
 	case "ecdsa":
 		privateKey, _ := ecdsa.GenerateKey(getCurve(), rand.Reader)
 		return privateKey, &privateKey.PublicKey
+	case "ed25519":
+		publicKey, privateKey, _ := ed25519.GenerateKey(rand.Reader)
+		return privateKey, publicKey
+	case "x25519":
+		privateKey := genX25519Key()
+		return privateKey, privateKey.Public()
 	default:
 		privateKey, _ := rsa.GenerateKey(rand.Reader, bits)
 		return privateKey, &privateKey.PublicKey
@@ -92,7 +103,7 @@ func genKeyPair() (interface{}, interface{}) {
 
 // exportPrivKey writes the private key to a file
 func exportPrivKey(key interface{}) error {
-	keyBytes, _ := x509.MarshalPKCS8PrivateKey(key)
+	keyBytes, _ := marshalPrivKeyDER(key)
 	keyPem := pem.EncodeToMemory(&pem.Block{
 		Type:  "PRIVATE KEY",
 		Bytes: keyBytes,
@@ -109,7 +120,7 @@ func exportPrivKey(key interface{}) error {
 
 // exportPubKey writes the public key to a file
 func exportPubKey(key interface{}) error {
-	keyBytes, _ := x509.MarshalPKIXPublicKey(key)
+	keyBytes, _ := marshalPubKeyDER(key)
 	keyPem := pem.EncodeToMemory(&pem.Block{
 		Type:  "PUBLIC KEY",
 		Bytes: keyBytes,
@@ -124,6 +135,18 @@ func exportPubKey(key interface{}) error {
 	return nil
 }
 
+// exportAgeKey writes an age X25519 identity and its recipient to files
+func exportAgeKey() error {
+	privateKey := genX25519Key()
+	if err := os.WriteFile(privKeyPath, []byte(marshalAgeIdentity(privateKey)), 0600); err != nil {
+		return errors.Wrap(err, "write identity file")
+	}
+	if err := os.WriteFile(pubKeyPath, []byte(bech32Encode("age", privateKey.Public())+"\n"), 0644); err != nil {
+		return errors.Wrap(err, "write recipient file")
+	}
+	return nil
+}
+
 func init() {
 	encCmd.AddCommand(NewAkgCmd())
 }
@@ -0,0 +1,250 @@
+/*
+Copyright © 2021 SignorMercurio
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package enc
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var (
+	detectECB    bool
+	flipCBC      bool
+	attackECB    bool
+	knownPlain   string
+	targetPlain  string
+	flipOffset   int
+	maxBlockSize int
+)
+
+// NewBlkCmd represents the blk command
+func NewBlkCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "blk",
+		Short: "Block cipher misuse analysis",
+		Long: `Block cipher misuse analysis
+--detect shows the block layout of the input ciphertext and detects ECB mode by repeated blocks.
+--flip flips the known plaintext at --offset into the target in an IV || ciphertext encrypted in CBC mode,
+garbling the preceding block unless the known plaintext lies in the first block.
+--attack recovers the secret appended to chosen plaintexts by an ECB encryption oracle, byte at a time.
+The oracle is an HTTP request template or a command template where {{PAYLOAD}} is replaced with the chosen plaintext,
+and responds with the ciphertext.
+Example:
+	att enc -i cipher.txt blk --detect
+	att enc -i cipher.txt blk --flip --known "admin=0" --target "admin=1" --offset 20
+	att enc blk --attack --url "http://127.0.0.1:8080/?data={{PAYLOAD}}" --fmt b64`,
+		Annotations: map[string]string{noInput: ""},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if attackECB {
+				if oracleURL == "" && oracleCmd == "" {
+					return errors.New("find any oracle. Please specify either --url or --cmd")
+				}
+				secret, err := ecbByteAtATime()
+				if err != nil {
+					return err
+				}
+				Echo(string(secret))
+				return nil
+			}
+
+			var err error
+			if inputBytes, err = getInput(); err != nil {
+				return err
+			}
+			encoded := string(inputBytes)
+			if payloadFmt != "raw" {
+				encoded = strings.TrimSpace(encoded)
+			}
+			cipherText, err := decodePayload(encoded)
+			if err != nil {
+				return err
+			}
+			if cipherBlock <= 0 || len(cipherText)%cipherBlock != 0 {
+				return errors.New("validate cipherText length")
+			}
+
+			if detectECB {
+				Echo(blockLayout(cipherText))
+			} else if flipCBC {
+				flipped, err := flipPlaintext(cipherText, []byte(knownPlain), []byte(targetPlain), flipOffset)
+				if err != nil {
+					return err
+				}
+				Echo(encodePayload(flipped))
+			} else {
+				NoActionSpecified()
+			}
+
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&detectECB, "detect", false, "Show the block layout and detect ECB mode")
+	cmd.Flags().BoolVar(&flipCBC, "flip", false, "CBC bit-flipping")
+	cmd.Flags().BoolVar(&attackECB, "attack", false, "ECB byte-at-a-time chosen-plaintext attack")
+	cmd.Flags().StringVar(&knownPlain, "known", "", "Known plaintext to flip")
+	cmd.Flags().StringVar(&targetPlain, "target", "", "Target plaintext of the same length")
+	cmd.Flags().IntVar(&flipOffset, "offset", 0, "Offset of the known plaintext in the plaintext (excluding IV)")
+	cmd.Flags().IntVarP(&cipherBlock, "block-size", "b", 16, "Block size of the cipher, detected by the oracle in the ECB attack")
+	cmd.Flags().IntVar(&maxBlockSize, "max-block-size", 64, "Maximum block size to try in the ECB attack")
+	addOracleFlags(cmd)
+
+	return cmd
+}
+
+// blockLayout lists the blocks of [cipherText], marking repeated ones
+func blockLayout(cipherText []byte) string {
+	var b strings.Builder
+	blocks := len(cipherText) / cipherBlock
+	fmt.Fprintf(&b, "Block size: %d\nBlocks: %d\n", cipherBlock, blocks)
+
+	first := map[string]int{}
+	repeated := 0
+	for i := 0; i < blocks; i++ {
+		block := hex.EncodeToString(cipherText[i*cipherBlock : (i+1)*cipherBlock])
+		fmt.Fprintf(&b, "%d: %s", i, block)
+		if j, ok := first[block]; ok {
+			fmt.Fprintf(&b, " (= %d)", j)
+			repeated++
+		} else {
+			first[block] = i
+		}
+		b.WriteString("\n")
+	}
+
+	if repeated > 0 {
+		fmt.Fprintf(&b, "Repeated blocks: %d, ECB mode likely", repeated)
+	} else {
+		b.WriteString("No repeated blocks")
+	}
+	return b.String()
+}
+
+// flipPlaintext XORs the block preceding [known] at [offset] so that it decrypts to [target] in CBC mode
+func flipPlaintext(cipherText, known, target []byte, offset int) ([]byte, error) {
+	if len(known) != len(target) {
+		return nil, errors.New("validate target: it should be as long as the known plaintext")
+	}
+	// the IV takes the first block
+	if offset < 0 || offset+len(known) > len(cipherText)-cipherBlock {
+		return nil, errors.New("validate offset: the known plaintext is out of the ciphertext")
+	}
+
+	flipped := append([]byte{}, cipherText...)
+	for i := range known {
+		flipped[offset+i] ^= known[i] ^ target[i]
+	}
+	return flipped, nil
+}
+
+// queryECB encrypts [plainText] with the ECB oracle
+func queryECB(plainText []byte) ([]byte, error) {
+	_, body, err := queryOracle(string(plainText))
+	if err != nil {
+		return nil, err
+	}
+
+	encoded := string(body)
+	if payloadFmt != "raw" {
+		encoded = strings.TrimSpace(encoded)
+	}
+	return decodePayload(encoded)
+}
+
+// ecbByteAtATime recovers the secret in ECB(prefix || chosen plaintext || secret)
+func ecbByteAtATime() ([]byte, error) {
+	base, err := queryECB(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// the ciphertext grows by a block once the chosen plaintext fills the padding
+	blockSize, padLen := 0, 0
+	for i := 1; i <= maxBlockSize && blockSize == 0; i++ {
+		c, err := queryECB(bytes.Repeat([]byte{'A'}, i))
+		if err != nil {
+			return nil, err
+		}
+		if len(c) > len(base) {
+			blockSize, padLen = len(c)-len(base), i
+		}
+	}
+	if blockSize == 0 {
+		return nil, errors.New("detect block size")
+	}
+
+	// align the chosen plaintext to a block boundary after the prefix
+	align, start := -1, 0
+	for p := 0; p < blockSize && align < 0; p++ {
+		c, err := queryECB(bytes.Repeat([]byte{'A'}, p+2*blockSize))
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i+2*blockSize <= len(c); i += blockSize {
+			if bytes.Equal(c[i:i+blockSize], c[i+blockSize:i+2*blockSize]) {
+				align, start = p, i
+				break
+			}
+		}
+	}
+	if align < 0 {
+		return nil, errors.New("detect ECB mode: no repeated blocks in the oracle output")
+	}
+	secretLen := len(base) - padLen - (start - align)
+
+	secret := make([]byte, 0, secretLen)
+	for n := 0; n < secretLen; n++ {
+		filler := bytes.Repeat([]byte{'A'}, align+blockSize-1-n%blockSize)
+		pos := start + n/blockSize*blockSize
+
+		c, err := queryECB(filler)
+		if err != nil {
+			return nil, err
+		}
+		if len(c) < pos+blockSize {
+			return nil, errors.New("validate oracle output length")
+		}
+		target := c[pos : pos+blockSize]
+
+		probe := append(append(filler, secret...), 0)
+		found := false
+		for b := 0; b < 256 && !found; b++ {
+			probe[len(probe)-1] = byte(b)
+			c, err := queryECB(probe)
+			if err != nil {
+				return nil, err
+			}
+			if len(c) >= pos+blockSize && bytes.Equal(c[pos:pos+blockSize], target) {
+				secret = append(secret, byte(b))
+				found = true
+			}
+		}
+		if !found {
+			return nil, errors.New("recover secret byte " + strconv.Itoa(n))
+		}
+	}
+
+	return secret, nil
+}
+
+func init() {
+	encCmd.AddCommand(NewBlkCmd())
+}
@@ -0,0 +1,563 @@
+/*
+Copyright © 2021 SignorMercurio
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package enc
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var (
+	subject   string
+	sans      []string
+	days      int
+	isCA      bool
+	caCrtPath string
+	caKeyPath string
+	rootsPath string
+	dnsName   string
+
+	keyUsageNames = []string{
+		"Digital Signature", "Content Commitment", "Key Encipherment", "Data Encipherment",
+		"Key Agreement", "Certificate Sign", "CRL Sign", "Encipher Only", "Decipher Only",
+	}
+	extKeyUsageNames = map[x509.ExtKeyUsage]string{
+		x509.ExtKeyUsageAny:             "Any",
+		x509.ExtKeyUsageServerAuth:      "Server Authentication",
+		x509.ExtKeyUsageClientAuth:      "Client Authentication",
+		x509.ExtKeyUsageCodeSigning:     "Code Signing",
+		x509.ExtKeyUsageEmailProtection: "Email Protection",
+		x509.ExtKeyUsageTimeStamping:    "Time Stamping",
+		x509.ExtKeyUsageOCSPSigning:     "OCSP Signing",
+	}
+	extensionNames = map[string]string{
+		"2.5.29.14":               "Subject Key Identifier",
+		"2.5.29.15":               "Key Usage",
+		"2.5.29.17":               "Subject Alternative Name",
+		"2.5.29.19":               "Basic Constraints",
+		"2.5.29.30":               "Name Constraints",
+		"2.5.29.31":               "CRL Distribution Points",
+		"2.5.29.32":               "Certificate Policies",
+		"2.5.29.35":               "Authority Key Identifier",
+		"2.5.29.37":               "Extended Key Usage",
+		"1.3.6.1.5.5.7.1.1":       "Authority Information Access",
+		"1.3.6.1.4.1.11129.2.4.2": "Certificate Transparency SCTs",
+	}
+)
+
+// NewCrtCmd represents the crt command
+func NewCrtCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "crt",
+		Short: "X.509 certificate operation",
+		Long: `X.509 certificate operation
+Example:
+	att enc -i chain.pem crt parse
+	att enc -o ca.pem crt self --priv ca.key --subject "CN=Lab CA" --ca
+	att enc -i priv.pem -o req.csr crt csr --subject "CN=lab.local" --san lab.local,127.0.0.1
+	att enc -i req.csr -o leaf.pem crt sign --ca-crt ca.pem --ca-key ca.key --days 30
+	att enc -i leaf.pem crt verify --roots ca.pem --host lab.local`,
+	}
+	cmd.AddCommand(
+		newCrtParseCmd(),
+		newCrtSelfCmd(),
+		newCrtCsrCmd(),
+		newCrtSignCmd(),
+		newCrtVerifyCmd(),
+	)
+
+	return cmd
+}
+
+func newCrtParseCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "parse",
+		Short: "Parse PEM / DER certificates and chains",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			certs, err := parseCerts(inputBytes)
+			if err != nil {
+				return err
+			}
+
+			infos := make([]string, len(certs))
+			for i, cert := range certs {
+				infos[i] = describeCert(cert)
+			}
+			Echo(strings.Join(infos, "\n"))
+			return nil
+		},
+	}
+
+	return cmd
+}
+
+func newCrtSelfCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:         "self",
+		Short:       "Create a self-signed certificate or a local CA",
+		Annotations: map[string]string{noInput: ""},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			signer, err := readSigner(privKeyPath)
+			if err != nil {
+				return err
+			}
+
+			name, err := parseSubject(subject)
+			if err != nil {
+				return err
+			}
+			template, err := newCertTemplate(name, signer.Public())
+			if err != nil {
+				return err
+			}
+
+			der, err := x509.CreateCertificate(rand.Reader, template, template, signer.Public(), signer)
+			if err != nil {
+				return errors.Wrap(err, "create certificate")
+			}
+			Echo(string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})))
+			return nil
+		},
+	}
+	addCertFlags(cmd)
+	cmd.Flags().StringVar(&privKeyPath, "priv", "./priv.pem", "Path of existing private key")
+
+	return cmd
+}
+
+func newCrtCsrCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "csr",
+		Short: "Generate a CSR from a private key",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			k, err := loadKey(inputBytes)
+			if err != nil {
+				return err
+			}
+			signer, ok := k.(crypto.Signer)
+			if !ok {
+				return errors.New("sign CSR with a public key")
+			}
+
+			name, err := parseSubject(subject)
+			if err != nil {
+				return err
+			}
+			template := &x509.CertificateRequest{Subject: name}
+			addSANs(&template.DNSNames, &template.IPAddresses, &template.EmailAddresses, &template.URIs)
+
+			der, err := x509.CreateCertificateRequest(rand.Reader, template, signer)
+			if err != nil {
+				return errors.Wrap(err, "create CSR")
+			}
+			Echo(string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})))
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&subject, "subject", "", `Subject, e.g. "CN=example.com,O=Org" or "/CN=example.com/O=Org"`)
+	cmd.Flags().StringSliceVar(&sans, "san", nil, "Subject alternative names: DNS names / IPs / emails / URIs")
+
+	return cmd
+}
+
+func newCrtSignCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "sign",
+		Short: "Issue a certificate from a CSR",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			csr, err := parseCSR(inputBytes)
+			if err != nil {
+				return err
+			}
+
+			caCerts, err := readCerts(caCrtPath)
+			if err != nil {
+				return err
+			}
+			caSigner, err := readSigner(caKeyPath)
+			if err != nil {
+				return err
+			}
+
+			template, err := newCertTemplate(csr.Subject, csr.PublicKey)
+			if err != nil {
+				return err
+			}
+			template.DNSNames = append(template.DNSNames, csr.DNSNames...)
+			template.IPAddresses = append(template.IPAddresses, csr.IPAddresses...)
+			template.EmailAddresses = append(template.EmailAddresses, csr.EmailAddresses...)
+			template.URIs = append(template.URIs, csr.URIs...)
+
+			der, err := x509.CreateCertificate(rand.Reader, template, caCerts[0], csr.PublicKey, caSigner)
+			if err != nil {
+				return errors.Wrap(err, "create certificate")
+			}
+			Echo(string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})))
+			return nil
+		},
+	}
+	addCertFlags(cmd)
+	cmd.Flags().StringVar(&caCrtPath, "ca-crt", "./ca.pem", "Path of the CA certificate")
+	cmd.Flags().StringVar(&caKeyPath, "ca-key", "./ca.key", "Path of the CA private key")
+
+	return cmd
+}
+
+func newCrtVerifyCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "verify",
+		Short: "Verify a certificate chain",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			certs, err := parseCerts(inputBytes)
+			if err != nil {
+				return err
+			}
+
+			opts := x509.VerifyOptions{
+				DNSName:       dnsName,
+				Intermediates: x509.NewCertPool(),
+				KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+			}
+			for _, cert := range certs[1:] {
+				opts.Intermediates.AddCert(cert)
+			}
+			if rootsPath != "" {
+				roots, err := readCerts(rootsPath)
+				if err != nil {
+					return err
+				}
+				opts.Roots = x509.NewCertPool()
+				for _, root := range roots {
+					opts.Roots.AddCert(root)
+				}
+			}
+
+			chains, err := certs[0].Verify(opts)
+			if err != nil {
+				return errors.Wrap(err, "verify certificate")
+			}
+
+			var b strings.Builder
+			for i, chain := range chains {
+				fmt.Fprintf(&b, "Chain %d:\n", i)
+				for _, cert := range chain {
+					fmt.Fprintf(&b, "  %s\n", cert.Subject)
+				}
+			}
+			Echo(b.String())
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&rootsPath, "roots", "", "Path of the trusted root bundle (default system roots)")
+	cmd.Flags().StringVar(&dnsName, "host", "", "DNS name to verify the leaf certificate against")
+
+	return cmd
+}
+
+// addCertFlags adds the flags shared by commands issuing certificates
+func addCertFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&subject, "subject", "", `Subject, e.g. "CN=example.com,O=Org" or "/CN=example.com/O=Org"`)
+	cmd.Flags().StringSliceVar(&sans, "san", nil, "Subject alternative names: DNS names / IPs / emails / URIs")
+	cmd.Flags().IntVar(&days, "days", 365, "Validity period in days")
+	cmd.Flags().BoolVar(&isCA, "ca", false, "Issue a CA certificate")
+}
+
+// readSigner loads a private key from a file
+func readSigner(filename string) (crypto.Signer, error) {
+	keyBytes, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, errors.Wrap(err, "read key file")
+	}
+
+	k, err := loadKey(keyBytes)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := k.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("sign with a public key")
+	}
+
+	return signer, nil
+}
+
+// readCerts loads certificates from a file
+func readCerts(filename string) ([]*x509.Certificate, error) {
+	certBytes, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, errors.Wrap(err, "read certificate file")
+	}
+
+	return parseCerts(certBytes)
+}
+
+// parseCerts parses all certificates in a PEM bundle or a single DER certificate
+func parseCerts(certBytes []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+
+	rest := certBytes
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, errors.Wrap(err, "parse certificate")
+		}
+		certs = append(certs, cert)
+	}
+
+	if len(certs) == 0 {
+		cert, err := x509.ParseCertificate(certBytes)
+		if err != nil {
+			return nil, errors.Wrap(err, "parse certificate")
+		}
+		certs = append(certs, cert)
+	}
+
+	return certs, nil
+}
+
+// parseCSR parses a PEM / DER CSR and checks its signature
+func parseCSR(csrBytes []byte) (*x509.CertificateRequest, error) {
+	if block, _ := pem.Decode(csrBytes); block != nil {
+		csrBytes = block.Bytes
+	}
+
+	csr, err := x509.ParseCertificateRequest(csrBytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse CSR")
+	}
+	if err = csr.CheckSignature(); err != nil {
+		return nil, errors.Wrap(err, "check CSR signature")
+	}
+
+	return csr, nil
+}
+
+// parseSubject parses a subject in "CN=a,O=b" or "/CN=a/O=b" form
+func parseSubject(s string) (pkix.Name, error) {
+	var name pkix.Name
+
+	sep := ","
+	if strings.HasPrefix(s, "/") {
+		sep, s = "/", s[1:]
+	}
+	if s == "" {
+		return name, nil
+	}
+
+	for _, rdn := range strings.Split(s, sep) {
+		kv := strings.SplitN(strings.TrimSpace(rdn), "=", 2)
+		if len(kv) != 2 {
+			return name, errors.New("parse subject " + rdn)
+		}
+		k, v := strings.ToUpper(kv[0]), kv[1]
+
+		switch k {
+		case "CN":
+			name.CommonName = v
+		case "O":
+			name.Organization = append(name.Organization, v)
+		case "OU":
+			name.OrganizationalUnit = append(name.OrganizationalUnit, v)
+		case "C":
+			name.Country = append(name.Country, v)
+		case "ST":
+			name.Province = append(name.Province, v)
+		case "L":
+			name.Locality = append(name.Locality, v)
+		case "STREET":
+			name.StreetAddress = append(name.StreetAddress, v)
+		case "POSTALCODE":
+			name.PostalCode = append(name.PostalCode, v)
+		case "SERIALNUMBER":
+			name.SerialNumber = v
+		default:
+			return name, errors.New("recognize subject attribute " + k)
+		}
+	}
+
+	return name, nil
+}
+
+// addSANs sorts the SANs from user input by type
+func addSANs(dns *[]string, ips *[]net.IP, emails *[]string, uris *[]*url.URL) {
+	for _, san := range sans {
+		if ip := net.ParseIP(san); ip != nil {
+			*ips = append(*ips, ip)
+		} else if strings.Contains(san, "://") {
+			if uri, err := url.Parse(san); err == nil {
+				*uris = append(*uris, uri)
+			}
+		} else if strings.Contains(san, "@") {
+			*emails = append(*emails, san)
+		} else {
+			*dns = append(*dns, san)
+		}
+	}
+}
+
+// newCertTemplate creates a certificate template for [name] and [pub] from user input
+func newCertTemplate(name pkix.Name, pub crypto.PublicKey) (*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, errors.Wrap(err, "generate serial number")
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal pubkey")
+	}
+	skid := sha1.Sum(pubDER)
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               name,
+		NotBefore:             now.Add(-5 * time.Minute),
+		NotAfter:              now.AddDate(0, 0, days),
+		SubjectKeyId:          skid[:],
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+
+	if isCA {
+		template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature
+	} else {
+		template.KeyUsage = x509.KeyUsageDigitalSignature
+		if _, ok := pub.(*rsa.PublicKey); ok {
+			template.KeyUsage |= x509.KeyUsageKeyEncipherment
+		}
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+	}
+	addSANs(&template.DNSNames, &template.IPAddresses, &template.EmailAddresses, &template.URIs)
+
+	return template, nil
+}
+
+// describeCert lists the fields of a certificate
+func describeCert(cert *x509.Certificate) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "Subject: %s\n", cert.Subject)
+	fmt.Fprintf(&b, "Issuer: %s\n", cert.Issuer)
+	fmt.Fprintf(&b, "Serial: %x\n", cert.SerialNumber)
+	fmt.Fprintf(&b, "Not before: %s\n", cert.NotBefore.UTC().Format(time.RFC3339))
+	fmt.Fprintf(&b, "Not after: %s\n", cert.NotAfter.UTC().Format(time.RFC3339))
+	fmt.Fprintf(&b, "Signature algorithm: %s\n", cert.SignatureAlgorithm)
+	fmt.Fprintf(&b, "Public key algorithm: %s\n", cert.PublicKeyAlgorithm)
+
+	var names []string
+	names = append(names, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		names = append(names, ip.String())
+	}
+	names = append(names, cert.EmailAddresses...)
+	for _, uri := range cert.URIs {
+		names = append(names, uri.String())
+	}
+	if len(names) > 0 {
+		fmt.Fprintf(&b, "SANs: %s\n", strings.Join(names, ", "))
+	}
+
+	if cert.BasicConstraintsValid {
+		fmt.Fprintf(&b, "CA: %t\n", cert.IsCA)
+		if cert.IsCA && (cert.MaxPathLen > 0 || cert.MaxPathLenZero) {
+			fmt.Fprintf(&b, "Max path length: %d\n", cert.MaxPathLen)
+		}
+	}
+
+	var usages []string
+	for i, usage := range keyUsageNames {
+		if cert.KeyUsage&(1<<uint(i)) != 0 {
+			usages = append(usages, usage)
+		}
+	}
+	if len(usages) > 0 {
+		fmt.Fprintf(&b, "Key usage: %s\n", strings.Join(usages, ", "))
+	}
+
+	usages = nil
+	for _, usage := range cert.ExtKeyUsage {
+		if name, ok := extKeyUsageNames[usage]; ok {
+			usages = append(usages, name)
+		} else {
+			usages = append(usages, fmt.Sprintf("%d", usage))
+		}
+	}
+	for _, oid := range cert.UnknownExtKeyUsage {
+		usages = append(usages, oid.String())
+	}
+	if len(usages) > 0 {
+		fmt.Fprintf(&b, "Extended key usage: %s\n", strings.Join(usages, ", "))
+	}
+
+	if len(cert.Extensions) > 0 {
+		fmt.Fprintln(&b, "Extensions:")
+		for _, ext := range cert.Extensions {
+			oid := ext.Id.String()
+			name := extensionNames[oid]
+			if name == "" {
+				name = "Unknown"
+			}
+			critical := ""
+			if ext.Critical {
+				critical = " (critical)"
+			}
+			fmt.Fprintf(&b, "  %s %s%s\n", oid, name, critical)
+		}
+	}
+
+	sha1Sum, sha256Sum := sha1.Sum(cert.Raw), sha256.Sum256(cert.Raw)
+	fmt.Fprintf(&b, "SHA-1 fingerprint: %s\n", colonHex(sha1Sum[:]))
+	fmt.Fprintf(&b, "SHA-256 fingerprint: %s\n", colonHex(sha256Sum[:]))
+
+	return b.String()
+}
+
+// colonHex formats a digest in the colon-separated uppercase hex form used by openssl
+func colonHex(digest []byte) string {
+	hexes := make([]string, len(digest))
+	for i, v := range digest {
+		hexes[i] = fmt.Sprintf("%02X", v)
+	}
+	return strings.Join(hexes, ":")
+}
+
+func init() {
+	encCmd.AddCommand(NewCrtCmd())
+}
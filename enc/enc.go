@@ -35,6 +35,9 @@ var (
 	encCmd                    = NewEncCmd()
 )
 
+// noInput annotates subcommands that do not read the input before running
+const noInput = "noInput"
+
 // NewEncCmd represents the enc command
 func NewEncCmd() *cobra.Command {
 	cmd := &cobra.Command{
@@ -42,7 +45,7 @@ func NewEncCmd() *cobra.Command {
 		Short: "enc helps to deal with cryptographic operations",
 		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
 			var err error
-			if cmd.Use != "rnd" && cmd.Use != "rkg" {
+			if _, ok := cmd.Annotations[noInput]; !ok {
 				inputBytes, err = getInput()
 				if err != nil {
 					return err
@@ -0,0 +1,212 @@
+/*
+Copyright © 2021 SignorMercurio
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package enc
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var (
+	knownDigest  string
+	hashAlg      string
+	appendData   string
+	secretLength string
+	forgeFmt     string
+)
+
+// lengthExtension describes how to resume a Merkle–Damgård hash from its digest
+type lengthExtension struct {
+	new       func() hash.Hash
+	magic     string
+	wordSize  int
+	blockSize int
+	// lenSize is the size of the message length field in the padding
+	lenSize      int
+	littleEndian bool
+}
+
+// lengthExtensions lists the hashes vulnerable to length extension
+var lengthExtensions = map[string]lengthExtension{
+	"md5":    {new: md5.New, magic: "md5\x01", wordSize: 4, blockSize: 64, lenSize: 8, littleEndian: true},
+	"sha1":   {new: sha1.New, magic: "sha\x01", wordSize: 4, blockSize: 64, lenSize: 8},
+	"sha256": {new: sha256.New, magic: "sha\x03", wordSize: 4, blockSize: 64, lenSize: 8},
+	"sha512": {new: sha512.New, magic: "sha\x07", wordSize: 8, blockSize: 128, lenSize: 16},
+}
+
+// NewHleCmd represents the hle command
+func NewHleCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "hle",
+		Short: "Hash length extension attack",
+		Long: `Hash length extension attack against H(secret || msg) MACs
+Input is the original message, the hash algorithm is inferred from the digest length unless specified
+Example:
+	echo -n "user=guest" | att enc hle --digest 2d5a... --append ";admin=1" -l 16
+	att enc -i msg.txt hle --digest 2d5a... --append ";admin=1" -l 8-32 -a sha1 -f hex`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			digest, err := hex.DecodeString(knownDigest)
+			if err != nil {
+				return errors.Wrap(err, "decode digest")
+			}
+			if hashAlg == "" {
+				if hashAlg, err = guessHashAlg(len(digest)); err != nil {
+					return err
+				}
+			}
+			ext, ok := lengthExtensions[hashAlg]
+			if !ok {
+				return errors.New("recognize hash algorithm " + hashAlg + ". Only md5 / sha1 / sha256 / sha512 are supported")
+			}
+			if len(digest) != ext.new().Size() {
+				return errors.New("validate digest length for " + hashAlg)
+			}
+
+			minLen, maxLen, err := parseLengthRange(secretLength)
+			if err != nil {
+				return err
+			}
+
+			var results []string
+			for secretLen := minLen; secretLen <= maxLen; secretLen++ {
+				forged, forgedDigest, err := ext.extend(digest, inputBytes, []byte(appendData), secretLen)
+				if err != nil {
+					return err
+				}
+				encoded, err := encodeForged(forged)
+				if err != nil {
+					return err
+				}
+				results = append(results, fmt.Sprintf("Secret length: %d\nDigest: %x\nMessage: %s", secretLen, forgedDigest, encoded))
+			}
+			Echo(strings.Join(results, "\n\n"))
+
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&knownDigest, "digest", "", "Known digest of H(secret || msg) in hex format")
+	cmd.Flags().StringVar(&appendData, "append", "", "Data to append")
+	cmd.Flags().StringVarP(&secretLength, "length", "l", "16", "Secret length, or a range like 8-32")
+	cmd.Flags().StringVarP(&hashAlg, "algorithm", "a", "", "Hash algorithm: md5 / sha1 / sha256 / sha512, inferred from the digest by default")
+	cmd.Flags().StringVarP(&forgeFmt, "format", "f", "url", "Format of the forged message: raw / hex / url")
+
+	return cmd
+}
+
+// guessHashAlg infers the hash algorithm from the digest size
+func guessHashAlg(size int) (string, error) {
+	for name, ext := range lengthExtensions {
+		if ext.new().Size() == size {
+			return name, nil
+		}
+	}
+	return "", errors.New("infer hash algorithm from a " + strconv.Itoa(size) + "-byte digest")
+}
+
+// parseLengthRange parses a length like 16 or a range like 8-32
+func parseLengthRange(s string) (int, int, error) {
+	bounds := strings.SplitN(s, "-", 2)
+	minLen, err := strconv.Atoi(bounds[0])
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "parse secret length")
+	}
+	maxLen := minLen
+	if len(bounds) == 2 {
+		if maxLen, err = strconv.Atoi(bounds[1]); err != nil {
+			return 0, 0, errors.Wrap(err, "parse secret length")
+		}
+	}
+	if minLen < 0 || maxLen < minLen {
+		return 0, 0, errors.New("validate secret length range")
+	}
+	return minLen, maxLen, nil
+}
+
+// padding returns the Merkle–Damgård padding of a message of [msgLen] bytes
+func (ext lengthExtension) padding(msgLen int) []byte {
+	padLen := ext.blockSize - (msgLen+1+ext.lenSize)%ext.blockSize
+	if padLen == ext.blockSize {
+		padLen = 0
+	}
+	pad := make([]byte, 1+padLen+ext.lenSize)
+	pad[0] = 0x80
+
+	bits := uint64(msgLen) << 3
+	if ext.littleEndian {
+		binary.LittleEndian.PutUint64(pad[len(pad)-ext.lenSize:], bits)
+	} else {
+		binary.BigEndian.PutUint64(pad[len(pad)-8:], bits)
+	}
+	return pad
+}
+
+// extend forges msg || padding || [suffix] and its digest from the digest of secret || [msg]
+func (ext lengthExtension) extend(digest, msg, suffix []byte, secretLen int) ([]byte, []byte, error) {
+	pad := ext.padding(secretLen + len(msg))
+	forged := append(append(append([]byte{}, msg...), pad...), suffix...)
+	processed := secretLen + len(msg) + len(pad)
+
+	// resume the hash from the state in the digest through its marshaled form
+	state := []byte(ext.magic)
+	for i := 0; i < len(digest); i += ext.wordSize {
+		word := digest[i : i+ext.wordSize]
+		if ext.littleEndian {
+			state = append(state, word[3], word[2], word[1], word[0])
+		} else {
+			state = append(state, word...)
+		}
+	}
+	state = append(state, make([]byte, ext.blockSize+8)...)
+	binary.BigEndian.PutUint64(state[len(state)-8:], uint64(processed))
+
+	h := ext.new()
+	if err := h.(encoding.BinaryUnmarshaler).UnmarshalBinary(state); err != nil {
+		return nil, nil, errors.Wrap(err, "restore hash state")
+	}
+	h.Write(suffix)
+
+	return forged, h.Sum(nil), nil
+}
+
+// encodeForged encodes the forged message in the specified format
+func encodeForged(forged []byte) (string, error) {
+	switch forgeFmt {
+	case "raw":
+		return string(forged), nil
+	case "hex":
+		return hex.EncodeToString(forged), nil
+	case "url":
+		return url.QueryEscape(string(forged)), nil
+	}
+	return "", errors.New("recognize format " + forgeFmt)
+}
+
+func init() {
+	encCmd.AddCommand(NewHleCmd())
+}
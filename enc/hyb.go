@@ -0,0 +1,384 @@
+/*
+Copyright © 2021 SignorMercurio
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package enc
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	hybMagic     = "att-hybrid-v1"
+	hybChunkSize = 64 * 1024
+)
+
+var (
+	recipients []string
+	dataCipher string
+)
+
+// hybHeader is the self-describing header of a hybrid encrypted file
+type hybHeader struct {
+	Cipher     string          `json:"cipher"`
+	Recipients []*hybRecipient `json:"recipients"`
+}
+
+// hybRecipient holds the data key wrapped for one recipient
+type hybRecipient struct {
+	Type        string `json:"type"`
+	Fingerprint string `json:"fingerprint"`
+	Epk         string `json:"epk,omitempty"`
+	Key         string `json:"key"`
+}
+
+// NewHybCmd represents the hyb command
+func NewHybCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "hyb",
+		Short: "Hybrid file encryption / decryption with public keys",
+		Long: `Hybrid file encryption / decryption with public keys
+The file is encrypted with a random AES-256-GCM / ChaCha20-Poly1305 data key in 64 KiB chunks,
+and the data key is wrapped for each RSA (OAEP), EC (ECDH) or X25519 recipient.
+Input is streamed, so it must not be the same file as the output
+Example:
+	att enc -i in.txt -o out.bin hyb -e --pub alice.pem --pub bob.pem -c chacha
+	att enc -i out.bin hyb -d --priv bob_priv.pem`,
+		Annotations: map[string]string{noInput: ""},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var in io.Reader = os.Stdin
+			if inputFile != "" {
+				f, err := os.Open(inputFile)
+				if err != nil {
+					return errors.Wrap(err, "open input file")
+				}
+				defer f.Close()
+				in = f
+			}
+
+			if enc {
+				return hybEncrypt(in, output)
+			} else if dec {
+				return hybDecrypt(in, output)
+			} else {
+				NoActionSpecified()
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVarP(&enc, "encrypt", "e", false, "Hybrid encryption")
+	cmd.Flags().BoolVarP(&dec, "decrypt", "d", false, "Hybrid decryption")
+	cmd.Flags().StringArrayVar(&recipients, "pub", []string{"./pub.pem"}, "Public key of a recipient, can be repeated")
+	cmd.Flags().StringVar(&privKeyPath, "priv", "./priv.pem", "Path of the private key to decrypt with")
+	cmd.Flags().StringVarP(&dataCipher, "cipher", "c", "aes", "Data cipher: aes (AES-256-GCM) / chacha (ChaCha20-Poly1305)")
+
+	return cmd
+}
+
+// newDataAEAD creates the AEAD of the data cipher
+func newDataAEAD(name string, dataKey []byte) (cipher.AEAD, error) {
+	switch name {
+	case "aes-256-gcm":
+		block, _ := aes.NewCipher(dataKey)
+		return cipher.NewGCM(block)
+	case "chacha20-poly1305":
+		return chacha20poly1305.New(dataKey)
+	default:
+		return nil, errors.New("recognize data cipher " + name)
+	}
+}
+
+// hybEncrypt encrypts [in] for all the recipients, writing the container to [out]
+func hybEncrypt(in io.Reader, out io.Writer) error {
+	header := &hybHeader{Cipher: "aes-256-gcm"}
+	if dataCipher == "chacha" {
+		header.Cipher = "chacha20-poly1305"
+	}
+	dataKey := genNonce(chacha20poly1305.KeySize)
+
+	for _, path := range recipients {
+		keyBytes, err := os.ReadFile(path)
+		if err != nil {
+			return errors.Wrap(err, "read pubkey file")
+		}
+		k, err := loadKey(keyBytes)
+		if err != nil {
+			return err
+		}
+		r, err := wrapDataKey(dataKey, publicKey(k))
+		if err != nil {
+			return err
+		}
+		header.Recipients = append(header.Recipients, r)
+	}
+
+	headerJSON, _ := json.Marshal(header)
+	aead, err := newDataAEAD(header.Cipher, dataKey)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(out, hybMagic+"\n"+string(headerJSON)+"\n"); err != nil {
+		return errors.Wrap(err, "write header")
+	}
+
+	return sealChunks(bufio.NewReader(in), out, aead, headerJSON)
+}
+
+// hybDecrypt decrypts a container from [in] with the private key, writing the plaintext to [out]
+func hybDecrypt(in io.Reader, out io.Writer) error {
+	br := bufio.NewReader(in)
+	magic, err := br.ReadString('\n')
+	if err != nil || strings.TrimSpace(magic) != hybMagic {
+		return errors.New("recognize hybrid encrypted file")
+	}
+	headerJSON, err := br.ReadBytes('\n')
+	if err != nil {
+		return errors.Wrap(err, "read header")
+	}
+	headerJSON = bytes.TrimSuffix(headerJSON, []byte("\n"))
+
+	header := &hybHeader{}
+	if err := json.Unmarshal(headerJSON, header); err != nil {
+		return errors.Wrap(err, "unmarshal header")
+	}
+
+	keyBytes, err := os.ReadFile(privKeyPath)
+	if err != nil {
+		return errors.Wrap(err, "read privkey file")
+	}
+	priv, err := loadKey(keyBytes)
+	if err != nil {
+		return err
+	}
+	fingerprint, err := keyFingerprint(publicKey(priv))
+	if err != nil {
+		return err
+	}
+
+	var dataKey []byte
+	for _, r := range header.Recipients {
+		if r.Fingerprint == fingerprint {
+			if dataKey, err = unwrapDataKey(r, priv); err != nil {
+				return err
+			}
+			break
+		}
+	}
+	if dataKey == nil {
+		return errors.New("find a recipient matching the private key")
+	}
+
+	aead, err := newDataAEAD(header.Cipher, dataKey)
+	if err != nil {
+		return err
+	}
+	return openChunks(br, out, aead, headerJSON)
+}
+
+// chunkNonce builds the nonce of a chunk from its counter and whether it is the last one
+func chunkNonce(counter uint64, last bool) []byte {
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	for i := 10; i >= 3; i-- {
+		nonce[i] = byte(counter)
+		counter >>= 8
+	}
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+// readChunk fills [buf] as far as possible, telling whether the input ends after it
+func readChunk(br *bufio.Reader, buf []byte) (int, bool, error) {
+	n, err := io.ReadFull(br, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return n, true, nil
+	}
+	if err != nil {
+		return 0, false, errors.Wrap(err, "read input")
+	}
+	if _, err := br.Peek(1); err == io.EOF {
+		return n, true, nil
+	}
+	return n, false, nil
+}
+
+// sealChunks encrypts [br] chunk by chunk to [out]
+func sealChunks(br *bufio.Reader, out io.Writer, aead cipher.AEAD, ad []byte) error {
+	buf := make([]byte, hybChunkSize)
+	for counter := uint64(0); ; counter++ {
+		n, last, err := readChunk(br, buf)
+		if err != nil {
+			return err
+		}
+		sealed := aead.Seal(nil, chunkNonce(counter, last), buf[:n], ad)
+		if _, err := out.Write(sealed); err != nil {
+			return errors.Wrap(err, "write output")
+		}
+		if last {
+			return nil
+		}
+	}
+}
+
+// openChunks decrypts [br] chunk by chunk to [out]
+func openChunks(br *bufio.Reader, out io.Writer, aead cipher.AEAD, ad []byte) error {
+	buf := make([]byte, hybChunkSize+aead.Overhead())
+	for counter := uint64(0); ; counter++ {
+		n, last, err := readChunk(br, buf)
+		if err != nil {
+			return err
+		}
+		plain, err := aead.Open(nil, chunkNonce(counter, last), buf[:n], ad)
+		if err != nil {
+			return errors.Wrap(err, "decrypt chunk")
+		}
+		if _, err := out.Write(plain); err != nil {
+			return errors.Wrap(err, "write output")
+		}
+		if last {
+			return nil
+		}
+	}
+}
+
+// keyFingerprint computes the SHA-256 fingerprint of a public key in PKIX form
+func keyFingerprint(pub interface{}) (string, error) {
+	der, err := marshalPubKeyDER(pub)
+	if err != nil {
+		return "", errors.Wrap(err, "marshal pubkey")
+	}
+	digest := sha256.Sum256(der)
+	return hex.EncodeToString(digest[:]), nil
+}
+
+// wrapDataKey wraps [dataKey] for the recipient public key [pub]
+func wrapDataKey(dataKey []byte, pub interface{}) (*hybRecipient, error) {
+	fingerprint, err := keyFingerprint(pub)
+	if err != nil {
+		return nil, err
+	}
+	r := &hybRecipient{Fingerprint: fingerprint}
+
+	var secret, epk, recipientPub []byte
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		wrapped, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, pub, dataKey, []byte(hybMagic))
+		if err != nil {
+			return nil, errors.Wrap(err, "wrap data key")
+		}
+		r.Type = "rsa-oaep"
+		r.Key = base64.StdEncoding.EncodeToString(wrapped)
+		return r, nil
+	case *ecdsa.PublicKey:
+		ephemeral, err := ecdsa.GenerateKey(pub.Curve, rand.Reader)
+		if err != nil {
+			return nil, errors.Wrap(err, "generate ephemeral key")
+		}
+		x, _ := pub.Curve.ScalarMult(pub.X, pub.Y, ephemeral.D.Bytes())
+		secret = x.FillBytes(make([]byte, (pub.Curve.Params().BitSize+7)/8))
+		epk = elliptic.Marshal(pub.Curve, ephemeral.X, ephemeral.Y)
+		recipientPub = elliptic.Marshal(pub.Curve, pub.X, pub.Y)
+		r.Type = "ecdh"
+	case x25519PublicKey:
+		ephemeral := genX25519Key()
+		if secret, err = x25519(ephemeral, pub); err != nil {
+			return nil, err
+		}
+		epk, recipientPub = ephemeral.Public(), pub
+		r.Type = "x25519"
+	default:
+		return nil, errors.New("wrap data key for unsupported key type")
+	}
+
+	aead, _ := chacha20poly1305.New(deriveKEK(secret, epk, recipientPub))
+	r.Epk = base64.StdEncoding.EncodeToString(epk)
+	r.Key = base64.StdEncoding.EncodeToString(aead.Seal(nil, make([]byte, aead.NonceSize()), dataKey, nil))
+	return r, nil
+}
+
+// unwrapDataKey unwraps the data key of recipient [r] with the private key [priv]
+func unwrapDataKey(r *hybRecipient, priv interface{}) ([]byte, error) {
+	wrapped, err := base64.StdEncoding.DecodeString(r.Key)
+	if err != nil {
+		return nil, errors.Wrap(err, "decode wrapped data key")
+	}
+	epk, err := base64.StdEncoding.DecodeString(r.Epk)
+	if err != nil {
+		return nil, errors.Wrap(err, "decode ephemeral key")
+	}
+
+	var secret, recipientPub []byte
+	switch priv := priv.(type) {
+	case *rsa.PrivateKey:
+		dataKey, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, priv, wrapped, []byte(hybMagic))
+		if err != nil {
+			return nil, errors.Wrap(err, "unwrap data key")
+		}
+		return dataKey, nil
+	case *ecdsa.PrivateKey:
+		x, y := elliptic.Unmarshal(priv.Curve, epk)
+		if x == nil {
+			return nil, errors.New("parse ephemeral key")
+		}
+		sx, _ := priv.Curve.ScalarMult(x, y, priv.D.Bytes())
+		secret = sx.FillBytes(make([]byte, (priv.Curve.Params().BitSize+7)/8))
+		recipientPub = elliptic.Marshal(priv.Curve, priv.X, priv.Y)
+	case x25519PrivateKey:
+		if secret, err = x25519(priv, epk); err != nil {
+			return nil, err
+		}
+		recipientPub = priv.Public()
+	default:
+		return nil, errors.New("unwrap data key with unsupported key type")
+	}
+
+	aead, _ := chacha20poly1305.New(deriveKEK(secret, epk, recipientPub))
+	dataKey, err := aead.Open(nil, make([]byte, aead.NonceSize()), wrapped, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "unwrap data key")
+	}
+	return dataKey, nil
+}
+
+// deriveKEK derives the key-encryption key from an ECDH shared secret with HKDF-SHA256
+func deriveKEK(secret, epk, recipientPub []byte) []byte {
+	salt := append(append([]byte{}, epk...), recipientPub...)
+	kek := make([]byte, chacha20poly1305.KeySize)
+	io.ReadFull(hkdf.New(sha256.New, secret, salt, []byte(hybMagic)), kek)
+	return kek
+}
+
+func init() {
+	encCmd.AddCommand(NewHybCmd())
+}
@@ -0,0 +1,240 @@
+/*
+Copyright © 2021 SignorMercurio
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package enc
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"hash"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// jweHeader is the protected header of a JWE
+type jweHeader struct {
+	Alg string `json:"alg"`
+	Enc string `json:"enc"`
+	Kid string `json:"kid,omitempty"`
+	Epk *jwk   `json:"epk,omitempty"`
+	Apu string `json:"apu,omitempty"`
+	Apv string `json:"apv,omitempty"`
+}
+
+// getCEKSize gets the content encryption key size of [enc] in bytes
+func getCEKSize(enc string) (int, error) {
+	switch enc {
+	case "A128GCM":
+		return 16, nil
+	case "A192GCM":
+		return 24, nil
+	case "A256GCM":
+		return 32, nil
+	default:
+		return 0, errors.New("recognize JWE enc " + enc)
+	}
+}
+
+// getOAEPHash gets the OAEP hash function of a JWE RSA alg
+func getOAEPHash(alg string) hash.Hash {
+	if alg == "RSA-OAEP" {
+		return sha1.New()
+	}
+	return sha256.New()
+}
+
+// jweEncrypt encrypts [plainText] to a compact JWE for the key [k]
+func jweEncrypt(plainText []byte, k interface{}) (string, error) {
+	cekSize, err := getCEKSize(jweEnc)
+	if err != nil {
+		return "", err
+	}
+	header := &jweHeader{Alg: jweAlg, Enc: jweEnc, Kid: kid}
+
+	var cek, encryptedKey []byte
+	switch jweAlg {
+	case "dir":
+		secret, ok := k.([]byte)
+		if !ok || len(secret) != cekSize {
+			return "", errors.Errorf("load secret for dir: need %d bytes", cekSize)
+		}
+		cek = secret
+	case "RSA-OAEP", "RSA-OAEP-256":
+		pub, ok := publicKey(k).(*rsa.PublicKey)
+		if !ok {
+			return "", errors.New("load RSA key for " + jweAlg)
+		}
+		cek = genNonce(cekSize)
+		encryptedKey, err = rsa.EncryptOAEP(getOAEPHash(jweAlg), rand.Reader, pub, cek, nil)
+		if err != nil {
+			return "", errors.Wrap(err, "encrypt CEK")
+		}
+	case "ECDH-ES":
+		pub, ok := publicKey(k).(*ecdsa.PublicKey)
+		if !ok {
+			return "", errors.New("load EC key for ECDH-ES")
+		}
+		ephemeral, err := ecdsa.GenerateKey(pub.Curve, rand.Reader)
+		if err != nil {
+			return "", errors.Wrap(err, "generate ephemeral key")
+		}
+		header.Epk, _ = marshalJWK(&ephemeral.PublicKey)
+		cek = ecdhES(ephemeral, pub, header, cekSize)
+	default:
+		return "", errors.New("recognize JWE alg " + jweAlg)
+	}
+
+	headerJSON, _ := json.Marshal(header)
+	protected := b64url(headerJSON)
+
+	block, _ := aes.NewCipher(cek)
+	gcm, _ := cipher.NewGCM(block)
+	iv := genNonce(gcm.NonceSize())
+	sealed := gcm.Seal(nil, iv, plainText, []byte(protected))
+	cipherText, tag := sealed[:len(plainText)], sealed[len(plainText):]
+
+	return strings.Join([]string{
+		protected,
+		b64url(encryptedKey),
+		b64url(iv),
+		b64url(cipherText),
+		b64url(tag),
+	}, "."), nil
+}
+
+// jweDecrypt decrypts a compact JWE, loading the key with [getKey] given the alg and kid in the header
+func jweDecrypt(token string, getKey func(alg, kid string) (interface{}, error)) ([]byte, error) {
+	parts := strings.Split(strings.TrimSpace(token), ".")
+	if len(parts) != 5 {
+		return nil, errors.New("parse JWE")
+	}
+	segments := make([][]byte, 5)
+	for i, part := range parts {
+		segment, err := base64.RawURLEncoding.DecodeString(part)
+		if err != nil {
+			return nil, errors.Wrap(err, "decode JWE")
+		}
+		segments[i] = segment
+	}
+
+	header := &jweHeader{}
+	if err := json.Unmarshal(segments[0], header); err != nil {
+		return nil, errors.Wrap(err, "unmarshal JWE header")
+	}
+	cekSize, err := getCEKSize(header.Enc)
+	if err != nil {
+		return nil, err
+	}
+	k, err := getKey(header.Alg, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	var cek []byte
+	switch header.Alg {
+	case "dir":
+		secret, ok := k.([]byte)
+		if !ok {
+			return nil, errors.New("load secret for dir")
+		}
+		cek = secret
+	case "RSA-OAEP", "RSA-OAEP-256":
+		priv, ok := k.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("load RSA private key for " + header.Alg)
+		}
+		cek, err = rsa.DecryptOAEP(getOAEPHash(header.Alg), rand.Reader, priv, segments[1], nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "decrypt CEK")
+		}
+	case "ECDH-ES":
+		priv, ok := k.(*ecdsa.PrivateKey)
+		if !ok || header.Epk == nil {
+			return nil, errors.New("load EC private key for ECDH-ES")
+		}
+		epk, err := parseJWK(header.Epk)
+		if err != nil {
+			return nil, err
+		}
+		pub, ok := epk.(*ecdsa.PublicKey)
+		if !ok || pub.Curve != priv.Curve {
+			return nil, errors.New("validate ephemeral public key")
+		}
+		cek = ecdhES(priv, pub, header, cekSize)
+	default:
+		return nil, errors.New("recognize JWE alg " + header.Alg)
+	}
+
+	if len(cek) != cekSize {
+		return nil, errors.New("validate CEK size")
+	}
+	block, _ := aes.NewCipher(cek)
+	gcm, _ := cipher.NewGCM(block)
+	if len(segments[2]) != gcm.NonceSize() {
+		return nil, errors.New("validate JWE IV")
+	}
+	plainText, err := gcm.Open(nil, segments[2], append(segments[3], segments[4]...), []byte(parts[0]))
+	if err != nil {
+		return nil, errors.Wrap(err, "decrypt JWE")
+	}
+
+	return plainText, nil
+}
+
+// ecdhES derives the CEK of ECDH-ES with the Concat KDF in RFC 7518 section 4.6.2
+func ecdhES(priv *ecdsa.PrivateKey, pub *ecdsa.PublicKey, header *jweHeader, cekSize int) []byte {
+	x, _ := pub.Curve.ScalarMult(pub.X, pub.Y, priv.D.Bytes())
+	z := x.FillBytes(make([]byte, (pub.Curve.Params().BitSize+7)/8))
+
+	apu, _ := base64.RawURLEncoding.DecodeString(header.Apu)
+	apv, _ := base64.RawURLEncoding.DecodeString(header.Apv)
+
+	var otherInfo []byte
+	for _, field := range [][]byte{[]byte(header.Enc), apu, apv} {
+		otherInfo = append(otherInfo, lengthPrefixed(field)...)
+	}
+	keyDataLen := make([]byte, 4)
+	binary.BigEndian.PutUint32(keyDataLen, uint32(cekSize*8))
+	otherInfo = append(otherInfo, keyDataLen...)
+
+	var derived []byte
+	counter := make([]byte, 4)
+	for i := uint32(1); len(derived) < cekSize; i++ {
+		binary.BigEndian.PutUint32(counter, i)
+		h := sha256.New()
+		h.Write(counter)
+		h.Write(z)
+		h.Write(otherInfo)
+		derived = h.Sum(derived)
+	}
+
+	return derived[:cekSize]
+}
+
+// lengthPrefixed prefixes [b] with its 32-bit big-endian length
+func lengthPrefixed(b []byte) []byte {
+	prefixed := make([]byte, 4, 4+len(b))
+	binary.BigEndian.PutUint32(prefixed, uint32(len(b)))
+	return append(prefixed, b...)
+}
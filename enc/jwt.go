@@ -16,30 +16,99 @@ limitations under the License.
 package enc
 
 import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/x509"
 	"encoding/json"
+	"encoding/pem"
+	"fmt"
 	"os"
+	"runtime"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/SignorMercurio/attrezzi/cmd"
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
 
 var (
-	method string
+	method     string
+	decodeOnly bool
+	audience   string
+	issuer     string
+	leeway     time.Duration
+	confusion  bool
+	reencode   bool
+	kid        string
+	jku        string
+	x5u        string
+	wordlist   string
+	routines   int
+	headers    []string
+	exportFmt  string
+	encryptJWE bool
+	decryptJWE bool
+	jweAlg     string
+	jweEnc     string
+
+	standardClaims = []string{"iss", "sub", "aud", "exp", "nbf", "iat", "jti"}
+	timeClaims     = []string{"exp", "nbf", "iat"}
 )
 
 // NewJwtCmd represents the jwt command
 func NewJwtCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "jwt",
-		Short: "JWT-related operation",
-		Long: `JWT-related operation
+		Short: "JWT / JWE-related operation",
+		Long: `JWT / JWE-related operation
 Example:
-	att enc -i in.txt -o out.txt jwt -e
-	att enc -i out.txt jwt -d`,
+	att enc -i in.txt -o out.txt jwt -s
+	att enc -i out.txt jwt -v --aud api --iss auth.local --leeway 30s
+	att enc -i out.txt jwt -d
+	att enc -i in.txt jwt -s -m none --kid ../../../dev/null
+	att enc -i in.txt jwt -s -m hs256 -k pub.pem --confusion
+	att enc -i in.txt jwt -s -m hs256 -k priv.pem --confusion --pkix
+	att enc -i token.txt jwt --crack rockyou.txt -r 8
+	att enc -i in.txt jwt -s -m rs256 -k jwks.json --kid key-1 --header typ=at+jwt
+	att enc jwt --export jwks -m es256 -k ecpriv.pem
+	att enc -i in.txt jwt -e --alg ECDH-ES -k ecpub.pem
+	att enc -i out.txt jwt --decrypt -k ecpriv.pem`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			if enc {
+			if wordlist != "" {
+				secret, err := crackSecret(string(inputBytes))
+				if err != nil {
+					return err
+				}
+				Echo(secret)
+			} else if exportFmt != "" {
+				exported, err := exportKey()
+				if err != nil {
+					return err
+				}
+				Echo(exported)
+			} else if decodeOnly {
+				decoded, err := decodeToken(string(inputBytes))
+				if err != nil {
+					return err
+				}
+				Echo(decoded)
+			} else if encryptJWE {
+				token, err := encryptToken()
+				if err != nil {
+					return err
+				}
+				Echo(token)
+			} else if decryptJWE {
+				plainText, err := jweDecrypt(string(inputBytes), readJWEKey)
+				if err != nil {
+					return err
+				}
+				Echo(string(plainText))
+			} else if enc {
 				token, err := sign()
 				if err != nil {
 					return err
@@ -59,8 +128,25 @@ Example:
 	}
 	cmd.Flags().BoolVarP(&enc, "sign", "s", false, "JWT sign")
 	cmd.Flags().BoolVarP(&dec, "verify", "v", false, "JWT verify")
-	cmd.Flags().StringVarP(&key, "key", "k", "", "File storing the JWT secret key")
-	cmd.Flags().StringVarP(&method, "method", "m", "hs256", "JWT signing method: hs256 / hs384 / hs512 / rs256 / rs384 / rs512 / es256 / es384 / es512 / ps256 / ps384 / ps512")
+	cmd.Flags().BoolVarP(&decodeOnly, "decode", "d", false, "Decode header and claims without verification")
+	cmd.Flags().StringVar(&audience, "aud", "", "Required audience in JWT verify")
+	cmd.Flags().StringVar(&issuer, "iss", "", "Required issuer in JWT verify")
+	cmd.Flags().DurationVar(&leeway, "leeway", 0, "Leeway for exp / nbf / iat validation, e.g. 30s")
+	cmd.Flags().StringVarP(&key, "key", "k", "", "File storing the JWT secret key, PEM / OpenSSH key, JWK or JWKS")
+	cmd.Flags().StringVarP(&method, "method", "m", "hs256", "JWT signing method: hs256 / hs384 / hs512 / rs256 / rs384 / rs512 / es256 / es384 / es512 / ps256 / ps384 / ps512 / eddsa / none")
+	cmd.Flags().BoolVar(&confusion, "confusion", false, "Use the public key file as is as the HMAC secret (RS256 -> HS256 key confusion)")
+	cmd.Flags().BoolVar(&reencode, "pkix", false, "With --confusion, re-encode the key as a PKIX PUBLIC KEY PEM instead")
+	cmd.Flags().StringVar(&kid, "kid", "", "kid header to inject in JWT sign, also selecting the key in a JWKS")
+	cmd.Flags().StringVar(&jku, "jku", "", "jku header to inject in JWT sign")
+	cmd.Flags().StringVar(&x5u, "x5u", "", "x5u header to inject in JWT sign")
+	cmd.Flags().StringVar(&wordlist, "crack", "", "Wordlist to brute-force the HMAC secret with")
+	cmd.Flags().IntVarP(&routines, "routines", "r", runtime.NumCPU(), "Goroutines to use in brute force")
+	cmd.Flags().StringArrayVar(&headers, "header", nil, "Custom header name=value to add in JWT sign, value parsed as JSON if possible")
+	cmd.Flags().StringVar(&exportFmt, "export", "", "Export the key for the signing method: jwk / jwks")
+	cmd.Flags().BoolVarP(&encryptJWE, "encrypt", "e", false, "JWE encrypt")
+	cmd.Flags().BoolVar(&decryptJWE, "decrypt", false, "JWE decrypt")
+	cmd.Flags().StringVar(&jweAlg, "alg", "RSA-OAEP-256", "JWE key management alg: RSA-OAEP / RSA-OAEP-256 / ECDH-ES / dir")
+	cmd.Flags().StringVar(&jweEnc, "enc", "A256GCM", "JWE content encryption: A128GCM / A192GCM / A256GCM")
 
 	return cmd
 }
@@ -90,18 +176,42 @@ func getSigningMethod() jwt.SigningMethod {
 		return jwt.SigningMethodPS384
 	case "ps512":
 		return jwt.SigningMethodPS512
+	case "eddsa":
+		return jwt.SigningMethodEdDSA
+	case "none":
+		return jwt.SigningMethodNone
 	default:
 		return jwt.SigningMethodHS256
 	}
 }
 
-// readKey reads the JWT secret key from a file, parsing it from PEM if necessary
-func readKey() (interface{}, error) {
+// readKey reads the JWT secret key from a file, parsing it from PEM or JWK(S) if necessary
+func readKey(keyID string) (interface{}, error) {
+	if method == "none" {
+		return jwt.UnsafeAllowNoneSignatureType, nil
+	}
+
 	keyByte, err := os.ReadFile(key)
 	if err != nil {
 		return nil, errors.Wrap(err, "read key file")
 	}
 
+	if confusion {
+		return confusionKey(keyByte)
+	}
+
+	if bytes.HasPrefix(bytes.TrimSpace(keyByte), []byte("{")) {
+		j, err := selectJWK(keyByte, keyID)
+		if err != nil {
+			return nil, err
+		}
+		k, err := parseJWK(j)
+		if err != nil || enc {
+			return k, err
+		}
+		return publicKey(k), nil
+	}
+
 	switch method {
 	case "rs256", "rs384", "rs512", "ps256", "ps384", "ps512":
 		if enc {
@@ -131,22 +241,80 @@ func readKey() (interface{}, error) {
 			}
 			return ecPubKey, nil
 		}
+	case "eddsa":
+		edKey, err := loadKey(keyByte)
+		if err != nil {
+			return nil, err
+		}
+		if enc {
+			return edKey, nil
+		}
+		return publicKey(edKey), nil
 	default:
 		return keyByte, nil
 	}
 }
 
-// sign performs the JWT sign operation
+// confusionKey gets the HMAC secret used in key confusion, which is the public key file byte for byte
+// as the server reads it, unless re-encoding is asked for
+func confusionKey(keyByte []byte) ([]byte, error) {
+	if !strings.HasPrefix(method, "hs") {
+		return nil, errors.New("use key confusion with non-HMAC method")
+	}
+	if !reencode {
+		return keyByte, nil
+	}
+
+	k, err := loadKey(keyByte)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKIXPublicKey(publicKey(k))
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal pubkey")
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+}
+
+// sign performs the JWT sign operation, taking either JSON claims or an existing token to re-sign
 func sign() (string, error) {
 	var v = &jwt.MapClaims{}
+	header := map[string]interface{}{}
+
 	err := json.Unmarshal(inputBytes, v)
 	if err != nil {
-		return "", errors.Wrap(err, "unmarshal json")
+		orig, _, parseErr := new(jwt.Parser).ParseUnverified(strings.TrimSpace(string(inputBytes)), v)
+		if parseErr != nil {
+			return "", errors.Wrap(err, "unmarshal json")
+		}
+		header = orig.Header
 	}
 
 	token := jwt.NewWithClaims(getSigningMethod(), v)
+	for name, value := range header {
+		if name != "alg" {
+			token.Header[name] = value
+		}
+	}
+	for name, value := range map[string]string{"kid": kid, "jku": jku, "x5u": x5u} {
+		if value != "" {
+			token.Header[name] = value
+		}
+	}
+	for _, h := range headers {
+		idx := strings.Index(h, "=")
+		if idx <= 0 {
+			return "", errors.New("parse header " + h)
+		}
+		var value interface{}
+		if json.Unmarshal([]byte(h[idx+1:]), &value) != nil {
+			value = h[idx+1:]
+		}
+		token.Header[h[:idx]] = value
+	}
 
-	key, err := readKey()
+	key, err := readKey(kid)
 	if err != nil {
 		return "", err
 	}
@@ -154,17 +322,175 @@ func sign() (string, error) {
 	return token.SignedString(key)
 }
 
+// exportKey exports the key as a JWK, or a JWKS holding only its public half
+func exportKey() (string, error) {
+	keyByte, err := os.ReadFile(key)
+	if err != nil {
+		return "", errors.Wrap(err, "read key file")
+	}
+
+	var k interface{} = keyByte
+	if strings.HasPrefix(method, "hs") {
+		if exportFmt == "jwks" {
+			return "", errors.New("export HMAC secret as JWKS")
+		}
+	} else if k, err = loadKey(keyByte); err != nil {
+		return "", err
+	}
+	if exportFmt == "jwks" {
+		k = publicKey(k)
+	}
+
+	j, err := marshalJWK(k)
+	if err != nil {
+		return "", err
+	}
+	j.Kid = kid
+	if j.Kid == "" {
+		j.Kid = jwkThumbprint(j)
+	}
+	j.Use = "sig"
+	j.Alg = getSigningMethod().Alg()
+
+	var exported interface{}
+	switch exportFmt {
+	case "jwk":
+		exported = j
+	case "jwks":
+		exported = &jwks{Keys: []*jwk{j}}
+	default:
+		return "", errors.New("recognize export format " + exportFmt)
+	}
+
+	jsonContent, _ := json.MarshalIndent(exported, "", "  ")
+	return string(jsonContent), nil
+}
+
+// encryptToken performs the JWE encrypt operation on the input
+func encryptToken() (string, error) {
+	k, err := readJWEKey(jweAlg, kid)
+	if err != nil {
+		return "", err
+	}
+	return jweEncrypt(inputBytes, k)
+}
+
+// readJWEKey reads the JWE key from a file, using the raw bytes as the secret in dir mode
+func readJWEKey(alg, keyID string) (interface{}, error) {
+	keyByte, err := os.ReadFile(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "read key file")
+	}
+
+	if bytes.HasPrefix(bytes.TrimSpace(keyByte), []byte("{")) {
+		j, err := selectJWK(keyByte, keyID)
+		if err != nil {
+			return nil, err
+		}
+		return parseJWK(j)
+	}
+	if alg == "dir" {
+		return keyByte, nil
+	}
+	return loadKey(keyByte)
+}
+
+// crackSecret brute-forces the HMAC secret of a token with the words in the wordlist
+func crackSecret(tokenString string) (string, error) {
+	if routines < 1 {
+		return "", errors.Errorf("crack the secret with %d goroutines", routines)
+	}
+	parts := strings.Split(strings.TrimSpace(tokenString), ".")
+	if len(parts) != 3 {
+		return "", errors.New("parse the token")
+	}
+
+	token, _, err := new(jwt.Parser).ParseUnverified(strings.Join(parts, "."), jwt.MapClaims{})
+	if err != nil {
+		return "", errors.Wrap(err, "parse the token")
+	}
+	hmacMethod, ok := token.Method.(*jwt.SigningMethodHMAC)
+	if !ok {
+		return "", errors.New("crack the secret of non-HMAC token")
+	}
+	sig, err := jwt.DecodeSegment(parts[2])
+	if err != nil {
+		return "", errors.Wrap(err, "decode the signature")
+	}
+	signingString := []byte(parts[0] + "." + parts[1])
+
+	wordFile, err := os.Open(wordlist)
+	if err != nil {
+		return "", errors.Wrap(err, "open wordlist")
+	}
+	defer wordFile.Close()
+
+	var (
+		wg     sync.WaitGroup
+		once   sync.Once
+		secret *string
+		words  = make(chan string, routines)
+		found  = make(chan struct{})
+	)
+	for i := 0; i < routines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for word := range words {
+				mac := hmac.New(hmacMethod.Hash.New, []byte(word))
+				mac.Write(signingString)
+				if hmac.Equal(mac.Sum(nil), sig) {
+					once.Do(func() {
+						secret = &word
+						close(found)
+					})
+					return
+				}
+			}
+		}()
+	}
+
+	scanner := bufio.NewScanner(wordFile)
+feed:
+	for scanner.Scan() {
+		select {
+		case words <- scanner.Text():
+		case <-found:
+			break feed
+		}
+	}
+	close(words)
+	wg.Wait()
+
+	if secret != nil {
+		return *secret, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return "", errors.Wrap(err, "read wordlist")
+	}
+	return "", errors.New("crack the secret with the wordlist")
+}
+
 // verify performs the JWT verify operation
 func verify(tokenString string) (string, error) {
-	token, err := jwt.Parse(tokenString, func(t *jwt.Token) (interface{}, error) {
+	parser := &jwt.Parser{SkipClaimsValidation: true}
+	token, err := parser.Parse(tokenString, func(t *jwt.Token) (interface{}, error) {
 		if strings.ToLower(t.Method.Alg()) != method {
 			return nil, errors.New("Invalid signing alg")
 		}
-		return readKey()
+		keyID := kid
+		if headerKid, ok := t.Header["kid"].(string); ok && keyID == "" {
+			keyID = headerKid
+		}
+		return readKey(keyID)
 	})
 
 	if token != nil {
 		if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
+			warnMissingClaims(claims)
+			if err := validateClaims(claims); err != nil {
+				return "", err
+			}
 			jsonContent, _ := json.MarshalIndent(claims, "", "  ")
 			return string(jsonContent), nil
 		}
@@ -173,6 +499,71 @@ func verify(tokenString string) (string, error) {
 	return "", errors.Wrap(err, "validate the token")
 }
 
+// decodeToken shows the header and claims of a token without verifying it
+func decodeToken(tokenString string) (string, error) {
+	token, _, err := new(jwt.Parser).ParseUnverified(strings.TrimSpace(tokenString), jwt.MapClaims{})
+	if err != nil {
+		return "", errors.Wrap(err, "decode the token")
+	}
+	claims := token.Claims.(jwt.MapClaims)
+
+	header, _ := json.MarshalIndent(token.Header, "", "  ")
+	body, _ := json.MarshalIndent(claims, "", "  ")
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Header:\n%s\nClaims:\n%s\n", header, body)
+	for _, c := range timeClaims {
+		if ts, ok := claims[c].(float64); ok {
+			fmt.Fprintf(&b, "%s: %s\n", c, time.Unix(int64(ts), 0).UTC().Format(time.RFC3339))
+		}
+	}
+
+	warnMissingClaims(claims)
+	if err := validateClaims(claims); err != nil {
+		cmd.Log.Warnf("Failed to %s", err)
+	}
+
+	return b.String(), nil
+}
+
+// warnMissingClaims warns about standard claims missing in the token
+func warnMissingClaims(claims jwt.MapClaims) {
+	var missing []string
+	for _, c := range standardClaims {
+		if _, ok := claims[c]; !ok {
+			missing = append(missing, c)
+		}
+	}
+
+	if len(missing) > 0 {
+		cmd.Log.Warnf("Missing standard claims: %s", strings.Join(missing, ", "))
+	}
+}
+
+// validateClaims validates the time-based claims with leeway, and aud / iss if specified
+func validateClaims(claims jwt.MapClaims) error {
+	now := time.Now().Unix()
+	skew := int64(leeway.Seconds())
+
+	if !claims.VerifyExpiresAt(now-skew, false) {
+		return errors.New("validate exp: token is expired")
+	}
+	if !claims.VerifyNotBefore(now+skew, false) {
+		return errors.New("validate nbf: token is not valid yet")
+	}
+	if !claims.VerifyIssuedAt(now+skew, false) {
+		return errors.New("validate iat: token is issued in the future")
+	}
+	if audience != "" && !claims.VerifyAudience(audience, true) {
+		return errors.New("validate aud: token is not issued for " + audience)
+	}
+	if issuer != "" && !claims.VerifyIssuer(issuer, true) {
+		return errors.New("validate iss: token is not issued by " + issuer)
+	}
+
+	return nil
+}
+
 func init() {
 	encCmd.AddCommand(NewJwtCmd())
 }
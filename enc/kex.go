@@ -0,0 +1,380 @@
+/*
+Copyright © 2021 SignorMercurio
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package enc
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/hkdf"
+)
+
+var (
+	peerKeyPath string
+	classicDH   bool
+	checkDH     bool
+	dhP         string
+	dhG         string
+	dhQ         string
+	dhX         string
+	dhY         string
+	useHKDF     bool
+	hkdfSalt    string
+	hkdfInfo    string
+	hkdfLen     int
+)
+
+// smallPrimeBound bounds the trial division of p-1 in the DH parameter check
+const smallPrimeBound = 1 << 16
+
+// NewKexCmd represents the kex command
+func NewKexCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "kex",
+		Short: "ECDH / Diffie-Hellman key agreement",
+		Long: `ECDH / Diffie-Hellman key agreement
+Numbers in classic DH are decimal, or hex with the 0x prefix
+Example:
+	att enc kex --priv priv.pem --peer peer.pem --hkdf --info handshake --len 16
+	att enc kex --dh -p 0xffffffffffffffc5 -g 5 -x 1234 -y 0x2a
+	att enc kex --dh -p 0xffffffffffffffc5 -g 5
+	att enc kex --check -p 0xffffffffffffffc5 -g 5 -y 0x2a`,
+		Annotations: map[string]string{noInput: ""},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if checkDH {
+				report, err := checkDHParams()
+				if err != nil {
+					return err
+				}
+				Echo(report)
+				return nil
+			}
+
+			if useHKDF {
+				if max := 255 * getHash().Size(); hkdfLen < 1 || hkdfLen > max {
+					return errors.Errorf("validate HKDF length: it must be in [1, %d]", max)
+				}
+			}
+
+			var secret []byte
+			var err error
+			if classicDH {
+				if dhY == "" {
+					keyPair, err := genDHKeyPair()
+					if err != nil {
+						return err
+					}
+					Echo(keyPair)
+					return nil
+				}
+				secret, err = dhSharedSecret()
+			} else {
+				secret, err = ecdhSharedSecret()
+			}
+			if err != nil {
+				return err
+			}
+
+			if useHKDF {
+				secret, err = hkdfExpand(secret)
+				if err != nil {
+					return err
+				}
+			}
+			Echo(hex.EncodeToString(secret))
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&privKeyPath, "priv", "./priv.pem", "Path of own private key (EC or X25519)")
+	cmd.Flags().StringVar(&peerKeyPath, "peer", "./pub.pem", "Path of the peer public key")
+	cmd.Flags().BoolVar(&classicDH, "dh", false, "Use classic finite-field Diffie-Hellman, generating a key pair if -y is missing")
+	cmd.Flags().BoolVar(&checkDH, "check", false, "Check classic DH parameters for weaknesses")
+	cmd.Flags().StringVarP(&dhP, "prime", "p", "", "DH prime modulus p")
+	cmd.Flags().StringVarP(&dhG, "generator", "g", "2", "DH generator g")
+	cmd.Flags().StringVarP(&dhQ, "order", "q", "", "DH subgroup order q, optional")
+	cmd.Flags().StringVarP(&dhX, "private", "x", "", "Own DH private exponent x")
+	cmd.Flags().StringVarP(&dhY, "public", "y", "", "Peer DH public value y")
+	cmd.Flags().BoolVar(&useHKDF, "hkdf", false, "Post-process the shared secret with HKDF")
+	cmd.Flags().StringVar(&hkdfSalt, "salt", "", "HKDF salt in hex format")
+	cmd.Flags().StringVar(&hkdfInfo, "info", "", "HKDF info")
+	cmd.Flags().IntVar(&hkdfLen, "len", 32, "HKDF output length in bytes")
+	cmd.Flags().StringVar(&hashFunc, "hash", "sha256", "HKDF hash function: md5 / sha1 / sha256 / sha384 / sha512")
+
+	return cmd
+}
+
+// ecdhSharedSecret computes the ECDH / X25519 shared secret of own private key and the peer public key
+func ecdhSharedSecret() ([]byte, error) {
+	privBytes, err := os.ReadFile(privKeyPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "read privkey file")
+	}
+	priv, err := loadKey(privBytes)
+	if err != nil {
+		return nil, err
+	}
+	peerBytes, err := os.ReadFile(peerKeyPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "read peer pubkey file")
+	}
+	peer, err := loadKey(peerBytes)
+	if err != nil {
+		return nil, err
+	}
+	peer = publicKey(peer)
+
+	switch priv := priv.(type) {
+	case *ecdsa.PrivateKey:
+		pub, ok := peer.(*ecdsa.PublicKey)
+		if !ok || pub.Curve != priv.Curve {
+			return nil, errors.New("match the curve of the peer pubkey")
+		}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, errors.New("validate the peer pubkey")
+		}
+		x, _ := pub.Curve.ScalarMult(pub.X, pub.Y, priv.D.Bytes())
+		return x.FillBytes(make([]byte, (pub.Curve.Params().BitSize+7)/8)), nil
+	case x25519PrivateKey:
+		pub, ok := peer.(x25519PublicKey)
+		if !ok {
+			return nil, errors.New("match the curve of the peer pubkey")
+		}
+		return x25519(priv, pub)
+	default:
+		return nil, errors.New("agree on a key with non-EC / X25519 privkey")
+	}
+}
+
+// hkdfExpand derives key material from [secret] with HKDF
+func hkdfExpand(secret []byte) ([]byte, error) {
+	salt, err := hex.DecodeString(hkdfSalt)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse HKDF salt")
+	}
+
+	derived := make([]byte, hkdfLen)
+	if _, err := io.ReadFull(hkdf.New(getHash, secret, salt, []byte(hkdfInfo)), derived); err != nil {
+		return nil, errors.Wrap(err, "derive key with HKDF")
+	}
+	return derived, nil
+}
+
+// parseDHNumber parses a decimal or 0x-prefixed hex DH parameter
+func parseDHNumber(name, s string) (*big.Int, error) {
+	n, ok := new(big.Int).SetString(strings.TrimSpace(s), 0)
+	if !ok {
+		return nil, errors.New("parse DH parameter " + name)
+	}
+	return n, nil
+}
+
+// parseDHGroup parses p and g from user input
+func parseDHGroup() (*big.Int, *big.Int, error) {
+	p, err := parseDHNumber("p", dhP)
+	if err != nil {
+		return nil, nil, err
+	}
+	if p.Cmp(big.NewInt(3)) < 0 {
+		return nil, nil, errors.New("validate p: p must be greater than 2")
+	}
+	g, err := parseDHNumber("g", dhG)
+	if err != nil {
+		return nil, nil, err
+	}
+	return p, g, nil
+}
+
+// genDHKeyPair generates a classic DH key pair in the group from user input
+func genDHKeyPair() (string, error) {
+	p, g, err := parseDHGroup()
+	if err != nil {
+		return "", err
+	}
+	if p.Cmp(big.NewInt(3)) < 0 {
+		return "", errors.New("validate DH prime p")
+	}
+
+	// x in [2, p-2]
+	x, err := rand.Int(rand.Reader, new(big.Int).Sub(p, big.NewInt(3)))
+	if err != nil {
+		return "", errors.Wrap(err, "generate DH private exponent")
+	}
+	x.Add(x, big.NewInt(2))
+	y := new(big.Int).Exp(g, x, p)
+
+	return fmt.Sprintf("x: 0x%x\ny: 0x%x\n", x, y), nil
+}
+
+// dhSharedSecret computes the classic DH shared secret y^x mod p, padded to the size of p
+func dhSharedSecret() ([]byte, error) {
+	p, _, err := parseDHGroup()
+	if err != nil {
+		return nil, err
+	}
+	x, err := parseDHNumber("x", dhX)
+	if err != nil {
+		return nil, err
+	}
+	y, err := parseDHNumber("y", dhY)
+	if err != nil {
+		return nil, err
+	}
+
+	if x.Sign() <= 0 {
+		return nil, errors.New("validate DH private value: x must be positive")
+	}
+	one := big.NewInt(1)
+	if y.Cmp(one) <= 0 || y.Cmp(new(big.Int).Sub(p, one)) >= 0 {
+		return nil, errors.New("validate peer DH public value: y must be in [2, p-2]")
+	}
+
+	secret := new(big.Int).Exp(y, x, p)
+	return secret.FillBytes(make([]byte, (p.BitLen()+7)/8)), nil
+}
+
+// checkDHParams reports weaknesses of classic DH parameters, e.g. small subgroups
+func checkDHParams() (string, error) {
+	p, g, err := parseDHGroup()
+	if err != nil {
+		return "", err
+	}
+	one := big.NewInt(1)
+	pMinus1 := new(big.Int).Sub(p, one)
+
+	var b strings.Builder
+	var warnings []string
+	yesNo := func(ok bool) string {
+		if ok {
+			return "yes"
+		}
+		return "no"
+	}
+
+	fmt.Fprintf(&b, "p size: %d bits\n", p.BitLen())
+	if p.BitLen() < 2048 {
+		warnings = append(warnings, "p is shorter than 2048 bits")
+	}
+
+	pPrime := p.ProbablyPrime(20)
+	fmt.Fprintf(&b, "p is prime: %s\n", yesNo(pPrime))
+	if !pPrime {
+		warnings = append(warnings, "p is not prime")
+	}
+
+	q := new(big.Int).Rsh(pMinus1, 1)
+	safe := pPrime && q.ProbablyPrime(20)
+	fmt.Fprintf(&b, "p is a safe prime: %s\n", yesNo(safe))
+
+	factors, cofactor := smallFactors(pMinus1)
+	if len(factors) > 0 {
+		names := make([]string, len(factors))
+		for i, f := range factors {
+			names[i] = f.String()
+		}
+		fmt.Fprintf(&b, "Small factors of p-1: %s\n", strings.Join(names, ", "))
+	}
+	if cofactor.Cmp(one) == 0 {
+		warnings = append(warnings, "p-1 is smooth, discrete logs are easy with Pohlig-Hellman")
+	} else if !safe && cofactor.BitLen() < 160 {
+		warnings = append(warnings, fmt.Sprintf("the largest subgroup of p-1 is at most %d bits", cofactor.BitLen()))
+	}
+
+	gValid := g.Cmp(one) > 0 && g.Cmp(pMinus1) < 0
+	fmt.Fprintf(&b, "g in [2, p-2]: %s\n", yesNo(gValid))
+	if !gValid {
+		warnings = append(warnings, "g generates a subgroup of order 1 or 2")
+	}
+
+	if dhQ != "" {
+		q, err = parseDHNumber("q", dhQ)
+		if err != nil {
+			return "", err
+		}
+		if q.Cmp(one) <= 0 {
+			return "", errors.New("validate q: q must be greater than 1")
+		}
+		fmt.Fprintf(&b, "q is prime: %s\n", yesNo(q.ProbablyPrime(20)))
+		divides := new(big.Int).Mod(pMinus1, q).Sign() == 0
+		fmt.Fprintf(&b, "q divides p-1: %s\n", yesNo(divides))
+		if !divides {
+			warnings = append(warnings, "q does not divide p-1")
+		}
+	}
+	if safe || dhQ != "" {
+		inSubgroup := new(big.Int).Exp(g, q, p).Cmp(one) == 0
+		fmt.Fprintf(&b, "g generates the order-q subgroup: %s\n", yesNo(inSubgroup))
+		if !inSubgroup && gValid && dhQ == "" {
+			warnings = append(warnings, "g generates a group of order 2q, leaking the lowest bit of x")
+		} else if !inSubgroup && gValid {
+			warnings = append(warnings, "g is outside the order-q subgroup")
+		}
+	}
+
+	if dhY != "" {
+		y, err := parseDHNumber("y", dhY)
+		if err != nil {
+			return "", err
+		}
+		yValid := y.Cmp(one) > 0 && y.Cmp(pMinus1) < 0
+		fmt.Fprintf(&b, "y in [2, p-2]: %s\n", yesNo(yValid))
+		if !yValid {
+			warnings = append(warnings, "y is in a subgroup of order 1 or 2")
+		}
+		if safe || dhQ != "" {
+			inSubgroup := new(big.Int).Exp(y, q, p).Cmp(one) == 0
+			fmt.Fprintf(&b, "y is in the order-q subgroup: %s\n", yesNo(inSubgroup))
+			if !inSubgroup && yValid {
+				warnings = append(warnings, "y is outside the order-q subgroup (small subgroup confinement)")
+			}
+		}
+	}
+
+	for _, w := range warnings {
+		fmt.Fprintf(&b, "Warning: %s\n", w)
+	}
+	return b.String(), nil
+}
+
+// smallFactors finds the distinct prime factors of [n] below smallPrimeBound, returning the remaining cofactor
+func smallFactors(n *big.Int) ([]*big.Int, *big.Int) {
+	var factors []*big.Int
+	rest := new(big.Int).Set(n)
+	mod := new(big.Int)
+
+	for f := int64(2); f < smallPrimeBound && rest.Cmp(big.NewInt(1)) > 0; f++ {
+		d := big.NewInt(f)
+		if mod.Mod(rest, d).Sign() != 0 {
+			continue
+		}
+		factors = append(factors, d)
+		for mod.Mod(rest, d).Sign() == 0 {
+			rest.Div(rest, d)
+		}
+	}
+	return factors, rest
+}
+
+func init() {
+	encCmd.AddCommand(NewKexCmd())
+}
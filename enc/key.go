@@ -0,0 +1,746 @@
+/*
+Copyright © 2021 SignorMercurio
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package enc
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/SignorMercurio/attrezzi/cmd"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+)
+
+var (
+	keyOutFmt  string
+	keySyntax  string
+	keyPublic  bool
+	passphrase string
+)
+
+// jwk is a JSON Web Key as defined in RFC 7517, RFC 7518 and RFC 8037
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+	D   string `json:"d,omitempty"`
+	P   string `json:"p,omitempty"`
+	Q   string `json:"q,omitempty"`
+	Dp  string `json:"dp,omitempty"`
+	Dq  string `json:"dq,omitempty"`
+	Qi  string `json:"qi,omitempty"`
+	K   string `json:"k,omitempty"`
+}
+
+// jwks is a JSON Web Key Set
+type jwks struct {
+	Keys []*jwk `json:"keys"`
+}
+
+// NewKeyCmd represents the key command
+func NewKeyCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "key",
+		Short: "Key inspection and conversion",
+		Long: `Key inspection and conversion
+Input can be a PEM / DER key (PKCS #1, PKCS #8, SEC 1, PKIX or X.509 certificate), an OpenSSH key, a JWK or an unencrypted PuTTY key
+Example:
+	att enc -i priv.pem key
+	att enc -i id_ed25519 -o pub.jwk key -p -f jwk
+	att enc -i priv.pem -o priv.der key -f der -s pkcs1`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			k, err := loadKey(inputBytes)
+			if err != nil {
+				return err
+			}
+			if keyPublic {
+				k = publicKey(k)
+			}
+
+			if keyOutFmt == "txt" {
+				info, err := describeKey(k)
+				if err != nil {
+					return err
+				}
+				Echo(info)
+				return nil
+			}
+
+			converted, err := convertKey(k)
+			if err != nil {
+				return err
+			}
+			Echo(string(converted))
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&keyOutFmt, "format", "f", "txt", "Output format: txt (key info) / pem / der / jwk / ssh")
+	cmd.Flags().StringVarP(&keySyntax, "syntax", "s", "pkcs8", "Key syntax in PEM / DER output: pkcs8 (PKIX for public keys) / pkcs1 / sec1")
+	cmd.Flags().BoolVarP(&keyPublic, "public", "p", false, "Extract the public key from a private key")
+	cmd.Flags().StringVar(&passphrase, "pass", "", "Passphrase of an encrypted PEM / OpenSSH private key")
+
+	return cmd
+}
+
+// sshCryptoPublicKey gets the standard library key of an SSH public key, unwrapping certificates
+func sshCryptoPublicKey(sshPubKey ssh.PublicKey) (crypto.PublicKey, error) {
+	if cert, ok := sshPubKey.(*ssh.Certificate); ok {
+		sshPubKey = cert.Key
+	}
+	cryptoPubKey, ok := sshPubKey.(ssh.CryptoPublicKey)
+	if !ok {
+		return nil, errors.New("convert SSH " + sshPubKey.Type() + " key")
+	}
+	return cryptoPubKey.CryptoPublicKey(), nil
+}
+
+// loadKey parses a private or public key in any supported format
+func loadKey(keyBytes []byte) (interface{}, error) {
+	trimmed := bytes.TrimSpace(keyBytes)
+
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		j, err := selectJWK(trimmed, "")
+		if err != nil {
+			return nil, err
+		}
+		return parseJWK(j)
+	case bytes.HasPrefix(trimmed, []byte("PuTTY-User-Key-File-")):
+		return parsePuTTYKey(trimmed)
+	case bytes.HasPrefix(trimmed, []byte("ssh-")), bytes.HasPrefix(trimmed, []byte("ecdsa-sha2-")),
+		bytes.HasPrefix(trimmed, []byte("sk-")):
+		sshPubKey, _, _, _, err := ssh.ParseAuthorizedKey(trimmed)
+		if err != nil {
+			return nil, errors.Wrap(err, "parse OpenSSH public key")
+		}
+		return sshCryptoPublicKey(sshPubKey)
+	}
+
+	block, _ := pem.Decode(trimmed)
+	if block == nil {
+		// raw DER
+		if privKey, err := parsePrivKeyDER(trimmed); err == nil {
+			return privKey, nil
+		}
+		return parsePubKeyDER(trimmed)
+	}
+
+	switch {
+	case block.Type == "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, errors.Wrap(err, "parse certificate")
+		}
+		return cert.PublicKey, nil
+	case strings.HasSuffix(block.Type, "PUBLIC KEY"):
+		return parsePubKeyDER(block.Bytes)
+	case block.Type == "OPENSSH PRIVATE KEY", x509.IsEncryptedPEMBlock(block):
+		var privKey interface{}
+		var err error
+		if passphrase != "" {
+			privKey, err = ssh.ParseRawPrivateKeyWithPassphrase(trimmed, []byte(passphrase))
+		} else {
+			privKey, err = ssh.ParseRawPrivateKey(trimmed)
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "parse OpenSSH private key")
+		}
+		if edPrivKey, ok := privKey.(*ed25519.PrivateKey); ok {
+			return *edPrivKey, nil
+		}
+		return privKey, nil
+	default:
+		return parsePrivKeyDER(block.Bytes)
+	}
+}
+
+// loadKeyFile loads a key from a file, selecting the key by [kid] if the file is a JWKS
+func loadKeyFile(filename string, kid string) (interface{}, error) {
+	keyBytes, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, errors.Wrap(err, "read key file")
+	}
+
+	if bytes.HasPrefix(bytes.TrimSpace(keyBytes), []byte("{")) {
+		j, err := selectJWK(keyBytes, kid)
+		if err != nil {
+			return nil, err
+		}
+		return parseJWK(j)
+	}
+	return loadKey(keyBytes)
+}
+
+// selectJWK unmarshals a JWK, or selects a JWK from a JWKS by [kid]
+func selectJWK(keyBytes []byte, kid string) (*jwk, error) {
+	var set jwks
+	if err := json.Unmarshal(keyBytes, &set); err != nil {
+		return nil, errors.Wrap(err, "unmarshal JWK")
+	}
+	if set.Keys == nil {
+		var j jwk
+		json.Unmarshal(keyBytes, &j)
+		set.Keys = []*jwk{&j}
+	}
+
+	for _, j := range set.Keys {
+		if (kid == "" && len(set.Keys) == 1) || (kid != "" && j.Kid == kid) {
+			return j, nil
+		}
+	}
+	if kid == "" {
+		return nil, errors.New("select JWK from JWKS without kid")
+	}
+	return nil, errors.New("find JWK with kid " + kid)
+}
+
+// jwkThumbprint computes the RFC 7638 thumbprint of a JWK
+func jwkThumbprint(j *jwk) string {
+	var members string
+	switch j.Kty {
+	case "RSA":
+		members = fmt.Sprintf(`{"e":"%s","kty":"RSA","n":"%s"}`, j.E, j.N)
+	case "EC":
+		members = fmt.Sprintf(`{"crv":"%s","kty":"EC","x":"%s","y":"%s"}`, j.Crv, j.X, j.Y)
+	case "OKP":
+		members = fmt.Sprintf(`{"crv":"%s","kty":"OKP","x":"%s"}`, j.Crv, j.X)
+	default:
+		members = fmt.Sprintf(`{"k":"%s","kty":"%s"}`, j.K, j.Kty)
+	}
+
+	digest := sha256.Sum256([]byte(members))
+	return b64url(digest[:])
+}
+
+// publicKey returns the public half of [k], or [k] itself if it is already public
+func publicKey(k interface{}) interface{} {
+	if xPrivKey, ok := k.(x25519PrivateKey); ok {
+		return xPrivKey.Public()
+	}
+	if signer, ok := k.(crypto.Signer); ok {
+		return signer.Public()
+	}
+	return k
+}
+
+// isPrivKey tells whether [k] is a private key
+func isPrivKey(k interface{}) bool {
+	switch k.(type) {
+	case crypto.Signer, x25519PrivateKey:
+		return true
+	default:
+		return false
+	}
+}
+
+// marshalPrivKeyDER marshals a private key to PKCS #8
+func marshalPrivKeyDER(k interface{}) ([]byte, error) {
+	if xPrivKey, ok := k.(x25519PrivateKey); ok {
+		return marshalX25519PrivKeyDER(xPrivKey)
+	}
+	return x509.MarshalPKCS8PrivateKey(k)
+}
+
+// marshalPubKeyDER marshals a public key to PKIX
+func marshalPubKeyDER(k interface{}) ([]byte, error) {
+	if xPubKey, ok := k.(x25519PublicKey); ok {
+		return marshalX25519PubKeyDER(xPubKey)
+	}
+	return x509.MarshalPKIXPublicKey(k)
+}
+
+// describeKey lists the type, parameters and fingerprints of a key
+func describeKey(k interface{}) (string, error) {
+	var b strings.Builder
+
+	visibility := "public"
+	if isPrivKey(k) {
+		visibility = "private"
+	}
+
+	switch pub := publicKey(k).(type) {
+	case *rsa.PublicKey:
+		fmt.Fprintf(&b, "Type: RSA %s key\n", visibility)
+		fmt.Fprintf(&b, "Size: %d bits\n", pub.N.BitLen())
+		fmt.Fprintf(&b, "Modulus: %x\n", pub.N)
+		fmt.Fprintf(&b, "Exponent: %d\n", pub.E)
+	case *ecdsa.PublicKey:
+		fmt.Fprintf(&b, "Type: ECDSA %s key\n", visibility)
+		fmt.Fprintf(&b, "Curve: %s\n", pub.Curve.Params().Name)
+		fmt.Fprintf(&b, "Size: %d bits\n", pub.Curve.Params().BitSize)
+		fmt.Fprintf(&b, "X: %x\n", pub.X)
+		fmt.Fprintf(&b, "Y: %x\n", pub.Y)
+	case ed25519.PublicKey:
+		fmt.Fprintf(&b, "Type: Ed25519 %s key\n", visibility)
+		fmt.Fprintf(&b, "Size: 256 bits\n")
+		fmt.Fprintf(&b, "Point: %x\n", []byte(pub))
+	case x25519PublicKey:
+		fmt.Fprintf(&b, "Type: X25519 %s key\n", visibility)
+		fmt.Fprintf(&b, "Size: 256 bits\n")
+		fmt.Fprintf(&b, "Point: %x\n", []byte(pub))
+	case []byte:
+		fmt.Fprintf(&b, "Type: symmetric key\n")
+		fmt.Fprintf(&b, "Size: %d bits\n", len(pub)*8)
+		return b.String(), nil
+	default:
+		return "", errors.New("recognize key type")
+	}
+
+	if sshPubKey, err := ssh.NewPublicKey(publicKey(k)); err == nil {
+		fmt.Fprintf(&b, "SSH fingerprint: %s\n", ssh.FingerprintSHA256(sshPubKey))
+		fmt.Fprintf(&b, "SSH MD5 fingerprint: %s\n", ssh.FingerprintLegacyMD5(sshPubKey))
+	}
+	der, err := marshalPubKeyDER(publicKey(k))
+	if err != nil {
+		return "", errors.Wrap(err, "marshal pubkey")
+	}
+	fmt.Fprintf(&b, "SHA-256 fingerprint: %x\n", sha256.Sum256(der))
+
+	return b.String(), nil
+}
+
+// convertKey converts a key to the format specified by user input
+func convertKey(k interface{}) ([]byte, error) {
+	switch keyOutFmt {
+	case "jwk":
+		j, err := marshalJWK(k)
+		if err != nil {
+			return nil, err
+		}
+		return json.MarshalIndent(j, "", "  ")
+	case "ssh":
+		if isPrivKey(k) {
+			return marshalOpenSSHPrivKey(k)
+		}
+		sshPubKey, err := ssh.NewPublicKey(k)
+		if err != nil {
+			return nil, errors.Wrap(err, "convert to OpenSSH public key")
+		}
+		return ssh.MarshalAuthorizedKey(sshPubKey), nil
+	case "der":
+		der, _, err := marshalKeyDER(k)
+		return der, err
+	default:
+		der, pemType, err := marshalKeyDER(k)
+		if err != nil {
+			return nil, err
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: pemType, Bytes: der}), nil
+	}
+}
+
+// marshalKeyDER marshals a key to DER in the syntax specified by user input, returning the PEM type as well
+func marshalKeyDER(k interface{}) ([]byte, string, error) {
+	var der []byte
+	var pemType string
+	var err error
+
+	switch keySyntax {
+	case "pkcs1":
+		switch k := k.(type) {
+		case *rsa.PrivateKey:
+			der, pemType = x509.MarshalPKCS1PrivateKey(k), "RSA PRIVATE KEY"
+		case *rsa.PublicKey:
+			der, pemType = x509.MarshalPKCS1PublicKey(k), "RSA PUBLIC KEY"
+		default:
+			return nil, "", errors.New("convert non-RSA key to PKCS #1")
+		}
+	case "sec1":
+		ecPrivKey, ok := k.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, "", errors.New("convert non-EC private key to SEC 1")
+		}
+		der, err = x509.MarshalECPrivateKey(ecPrivKey)
+		pemType = "EC PRIVATE KEY"
+	default:
+		if isPrivKey(k) {
+			der, err = marshalPrivKeyDER(k)
+			pemType = "PRIVATE KEY"
+		} else {
+			der, err = marshalPubKeyDER(k)
+			pemType = "PUBLIC KEY"
+		}
+	}
+	if err != nil {
+		return nil, "", errors.Wrap(err, "marshal key")
+	}
+
+	return der, pemType, nil
+}
+
+// b64url encodes a []byte in unpadded base64url as used in JWK
+func b64url(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// b64urlInt decodes an unpadded base64url big-endian integer
+func b64urlInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.Wrap(err, "decode JWK parameter")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// getCurveByName gets the elliptic curve from its JWK / NIST name
+func getCurveByName(name string) (elliptic.Curve, error) {
+	switch name {
+	case "P-224":
+		return elliptic.P224(), nil
+	case "P-256":
+		return elliptic.P256(), nil
+	case "P-384":
+		return elliptic.P384(), nil
+	case "P-521":
+		return elliptic.P521(), nil
+	default:
+		return nil, errors.New("recognize curve " + name)
+	}
+}
+
+// marshalJWK converts a key to a JWK
+func marshalJWK(k interface{}) (*jwk, error) {
+	switch k := k.(type) {
+	case *rsa.PrivateKey:
+		k.Precompute()
+		j, _ := marshalJWK(&k.PublicKey)
+		j.D = b64url(k.D.Bytes())
+		j.P = b64url(k.Primes[0].Bytes())
+		j.Q = b64url(k.Primes[1].Bytes())
+		j.Dp = b64url(k.Precomputed.Dp.Bytes())
+		j.Dq = b64url(k.Precomputed.Dq.Bytes())
+		j.Qi = b64url(k.Precomputed.Qinv.Bytes())
+		return j, nil
+	case *rsa.PublicKey:
+		return &jwk{
+			Kty: "RSA",
+			N:   b64url(k.N.Bytes()),
+			E:   b64url(big.NewInt(int64(k.E)).Bytes()),
+		}, nil
+	case *ecdsa.PrivateKey:
+		j, err := marshalJWK(&k.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		j.D = b64url(k.D.FillBytes(make([]byte, (k.Curve.Params().BitSize+7)/8)))
+		return j, nil
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		return &jwk{
+			Kty: "EC",
+			Crv: k.Curve.Params().Name,
+			X:   b64url(k.X.FillBytes(make([]byte, size))),
+			Y:   b64url(k.Y.FillBytes(make([]byte, size))),
+		}, nil
+	case ed25519.PrivateKey:
+		return &jwk{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			X:   b64url(k.Public().(ed25519.PublicKey)),
+			D:   b64url(k.Seed()),
+		}, nil
+	case ed25519.PublicKey:
+		return &jwk{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			X:   b64url(k),
+		}, nil
+	case x25519PrivateKey:
+		return &jwk{
+			Kty: "OKP",
+			Crv: "X25519",
+			X:   b64url(k.Public()),
+			D:   b64url(k),
+		}, nil
+	case x25519PublicKey:
+		return &jwk{
+			Kty: "OKP",
+			Crv: "X25519",
+			X:   b64url(k),
+		}, nil
+	case []byte:
+		return &jwk{
+			Kty: "oct",
+			K:   b64url(k),
+		}, nil
+	default:
+		return nil, errors.New("recognize key type")
+	}
+}
+
+// parseJWK converts a JWK to a key
+func parseJWK(j *jwk) (interface{}, error) {
+	switch j.Kty {
+	case "RSA":
+		n, err := b64urlInt(j.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := b64urlInt(j.E)
+		if err != nil {
+			return nil, err
+		}
+		pub := &rsa.PublicKey{N: n, E: int(e.Int64())}
+		if j.D == "" {
+			return pub, nil
+		}
+
+		priv := &rsa.PrivateKey{PublicKey: *pub}
+		if priv.D, err = b64urlInt(j.D); err != nil {
+			return nil, err
+		}
+		p, err := b64urlInt(j.P)
+		if err != nil {
+			return nil, err
+		}
+		q, err := b64urlInt(j.Q)
+		if err != nil {
+			return nil, err
+		}
+		priv.Primes = []*big.Int{p, q}
+		if err = priv.Validate(); err != nil {
+			return nil, errors.Wrap(err, "validate RSA key")
+		}
+		priv.Precompute()
+		return priv, nil
+	case "EC":
+		curve, err := getCurveByName(j.Crv)
+		if err != nil {
+			return nil, err
+		}
+		x, err := b64urlInt(j.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := b64urlInt(j.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("validate EC point")
+		}
+		pub := &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+		if j.D == "" {
+			return pub, nil
+		}
+
+		d, err := b64urlInt(j.D)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PrivateKey{PublicKey: *pub, D: d}, nil
+	case "OKP":
+		if j.Crv == "X25519" {
+			return parseX25519JWK(j)
+		}
+		if j.Crv != "Ed25519" {
+			return nil, errors.New("recognize curve " + j.Crv)
+		}
+		if j.D != "" {
+			seed, err := base64.RawURLEncoding.DecodeString(j.D)
+			if err != nil || len(seed) != ed25519.SeedSize {
+				return nil, errors.New("decode Ed25519 private key")
+			}
+			return ed25519.NewKeyFromSeed(seed), nil
+		}
+		x, err := base64.RawURLEncoding.DecodeString(j.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("decode Ed25519 public key")
+		}
+		return ed25519.PublicKey(x), nil
+	case "oct":
+		k, err := base64.RawURLEncoding.DecodeString(j.K)
+		if err != nil {
+			return nil, errors.Wrap(err, "decode JWK parameter")
+		}
+		return k, nil
+	default:
+		return nil, errors.New("recognize JWK type " + j.Kty)
+	}
+}
+
+// parsePuTTYKey parses a PuTTY .ppk key file (version 2 or 3).
+// Only the public half is available if the private key is encrypted, and the MAC is not checked.
+func parsePuTTYKey(ppk []byte) (interface{}, error) {
+	headers := map[string]string{}
+	blobs := map[string][]byte{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(ppk))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		idx := strings.Index(line, ": ")
+		if idx < 0 {
+			return nil, errors.New("parse PuTTY key header")
+		}
+		name, value := line[:idx], line[idx+2:]
+		headers[name] = value
+
+		if !strings.HasSuffix(name, "-Lines") {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, errors.Wrap(err, "parse PuTTY key line count")
+		}
+		var b64 strings.Builder
+		for i := 0; i < n && scanner.Scan(); i++ {
+			b64.WriteString(strings.TrimSpace(scanner.Text()))
+		}
+		blob, err := base64.StdEncoding.DecodeString(b64.String())
+		if err != nil {
+			return nil, errors.Wrap(err, "decode PuTTY key")
+		}
+		blobs[strings.TrimSuffix(name, "-Lines")] = blob
+	}
+
+	sshPubKey, err := ssh.ParsePublicKey(blobs["Public"])
+	if err != nil {
+		return nil, errors.Wrap(err, "parse PuTTY public key")
+	}
+	pub, err := sshCryptoPublicKey(sshPubKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if headers["Encryption"] != "none" {
+		cmd.Log.Warn("PuTTY private key is encrypted, only the public key is loaded")
+		return pub, nil
+	}
+
+	priv := blobs["Private"]
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		var w struct {
+			D    *big.Int
+			P    *big.Int
+			Q    *big.Int
+			Iqmp *big.Int
+			Rest []byte `ssh:"rest"`
+		}
+		if err := ssh.Unmarshal(priv, &w); err != nil {
+			return nil, errors.Wrap(err, "parse PuTTY private key")
+		}
+		rsaPrivKey := &rsa.PrivateKey{PublicKey: *pub, D: w.D, Primes: []*big.Int{w.P, w.Q}}
+		if err := rsaPrivKey.Validate(); err != nil {
+			return nil, errors.Wrap(err, "validate RSA key")
+		}
+		rsaPrivKey.Precompute()
+		return rsaPrivKey, nil
+	case *ecdsa.PublicKey:
+		var w struct {
+			D    *big.Int
+			Rest []byte `ssh:"rest"`
+		}
+		if err := ssh.Unmarshal(priv, &w); err != nil {
+			return nil, errors.Wrap(err, "parse PuTTY private key")
+		}
+		return &ecdsa.PrivateKey{PublicKey: *pub, D: w.D}, nil
+	case ed25519.PublicKey:
+		var w struct {
+			Seed []byte
+			Rest []byte `ssh:"rest"`
+		}
+		if err := ssh.Unmarshal(priv, &w); err != nil || len(w.Seed) != ed25519.SeedSize {
+			return nil, errors.New("parse PuTTY private key")
+		}
+		return ed25519.NewKeyFromSeed(w.Seed), nil
+	default:
+		return nil, errors.New("recognize PuTTY key type")
+	}
+}
+
+// marshalOpenSSHPrivKey marshals a private key to the unencrypted openssh-key-v1 format
+func marshalOpenSSHPrivKey(k interface{}) ([]byte, error) {
+	signer, err := ssh.NewSignerFromKey(k)
+	if err != nil {
+		return nil, errors.Wrap(err, "convert to OpenSSH private key")
+	}
+	pubKey := signer.PublicKey()
+
+	var keyFields []byte
+	switch k := k.(type) {
+	case *rsa.PrivateKey:
+		k.Precompute()
+		keyFields = ssh.Marshal(struct {
+			N, E, D, Iqmp, P, Q *big.Int
+		}{k.N, big.NewInt(int64(k.E)), k.D, k.Precomputed.Qinv, k.Primes[0], k.Primes[1]})
+	case *ecdsa.PrivateKey:
+		curve := strings.TrimPrefix(pubKey.Type(), "ecdsa-sha2-")
+		keyFields = ssh.Marshal(struct {
+			Curve string
+			Pub   []byte
+			D     *big.Int
+		}{curve, elliptic.Marshal(k.Curve, k.X, k.Y), k.D})
+	case ed25519.PrivateKey:
+		keyFields = ssh.Marshal(struct {
+			Pub  []byte
+			Priv []byte
+		}{k.Public().(ed25519.PublicKey), k})
+	}
+
+	check := make([]byte, 4)
+	rand.Read(check)
+	checkInt := binary.BigEndian.Uint32(check)
+
+	privSection := ssh.Marshal(struct {
+		Check1, Check2 uint32
+		KeyType        string
+	}{checkInt, checkInt, pubKey.Type()})
+	privSection = append(privSection, keyFields...)
+	privSection = append(privSection, ssh.Marshal(struct{ Comment string }{""})...)
+	for i := byte(1); len(privSection)%8 != 0; i++ {
+		privSection = append(privSection, i)
+	}
+
+	body := ssh.Marshal(struct {
+		CipherName, KdfName, KdfOpts string
+		NumKeys                      uint32
+		PubKey, PrivKeyBlock         []byte
+	}{"none", "none", "", 1, pubKey.Marshal(), privSection})
+
+	return pem.EncodeToMemory(&pem.Block{
+		Type:  "OPENSSH PRIVATE KEY",
+		Bytes: append([]byte("openssh-key-v1\x00"), body...),
+	}), nil
+}
+
+func init() {
+	encCmd.AddCommand(NewKeyCmd())
+}
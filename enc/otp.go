@@ -0,0 +1,468 @@
+/*
+Copyright © 2021 SignorMercurio
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package enc
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SignorMercurio/attrezzi/format"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var (
+	otpType    string
+	otpAlg     string
+	digits     int
+	period     int
+	counter    uint64
+	unixTime   int64
+	timeOffset time.Duration
+	otpCode    string
+	window     int
+	makeURI    bool
+	parseURI   bool
+	otpIssuer  string
+	otpAccount string
+)
+
+// otpParams holds the parameters of an OTP generator
+type otpParams struct {
+	Type      string
+	Secret    []byte
+	Issuer    string
+	Account   string
+	Algorithm string
+	Digits    int
+	Period    int
+	Counter   uint64
+}
+
+// NewOtpCmd represents the otp command
+func NewOtpCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "otp",
+		Short: "HOTP / TOTP one-time password generation / verification",
+		Long: `HOTP / TOTP one-time password generation / verification
+Input is a base32 secret, an otpauth:// URI, or an otpauth-migration:// URI exported by Google Authenticator
+Example:
+	echo -n JBSWY3DPEHPK3PXP | att enc otp
+	echo -n JBSWY3DPEHPK3PXP | att enc otp -t hotp -c 5 -a sha256 -n 8
+	att enc -i uri.txt otp --verify 123456 -w 2
+	att enc -i seed.txt otp --uri --issuer ACME --account alice@example.com
+	att enc -i migration.txt otp --parse`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			params, err := loadOTPParams(strings.TrimSpace(string(inputBytes)))
+			if err != nil {
+				return err
+			}
+
+			var results []string
+			for _, p := range params {
+				var result string
+				switch {
+				case parseURI:
+					result = describeOTP(p)
+				case makeURI:
+					result = marshalOTPURI(p)
+				case otpCode != "":
+					result, err = verifyOTP(p, otpCode)
+				default:
+					result, err = generateOTP(p)
+				}
+				if err != nil {
+					return err
+				}
+				if len(params) > 1 && !parseURI && !makeURI {
+					result = otpLabel(p) + ": " + result
+				}
+				results = append(results, result)
+			}
+
+			separator := "\n"
+			if parseURI {
+				separator = "\n\n"
+			}
+			Echo(strings.Join(results, separator))
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&otpType, "type", "t", "totp", "OTP type: totp / hotp")
+	cmd.Flags().StringVarP(&otpAlg, "algorithm", "a", "sha1", "HMAC algorithm: sha1 / sha256 / sha512")
+	cmd.Flags().IntVarP(&digits, "digits", "n", 6, "Code digits: 6 / 7 / 8")
+	cmd.Flags().IntVarP(&period, "period", "p", 30, "TOTP period in seconds")
+	cmd.Flags().Uint64VarP(&counter, "counter", "c", 0, "HOTP counter")
+	cmd.Flags().Int64Var(&unixTime, "time", 0, "Unix time to generate the TOTP code at, 0 for now")
+	cmd.Flags().DurationVar(&timeOffset, "offset", 0, "Time offset added to the TOTP time, e.g. -30s")
+	cmd.Flags().StringVar(&otpCode, "verify", "", "Verify the code instead of generating one")
+	cmd.Flags().IntVarP(&window, "window", "w", 1, "Periods (TOTP) or counters (HOTP look-ahead) to accept around the current one in verification")
+	cmd.Flags().BoolVar(&makeURI, "uri", false, "Create an otpauth:// URI")
+	cmd.Flags().BoolVar(&parseURI, "parse", false, "Show the parameters of the input")
+	cmd.Flags().StringVar(&otpIssuer, "issuer", "", "Issuer in the otpauth:// URI")
+	cmd.Flags().StringVar(&otpAccount, "account", "", "Account name in the otpauth:// URI")
+
+	return cmd
+}
+
+// loadOTPParams parses the OTP parameters from a base32 secret, an otpauth:// URI or a migration URI
+func loadOTPParams(input string) ([]*otpParams, error) {
+	switch {
+	case strings.HasPrefix(input, "otpauth-migration://"):
+		return parseMigrationURI(input)
+	case strings.HasPrefix(input, "otpauth://"):
+		p, err := parseOTPURI(input)
+		if err != nil {
+			return nil, err
+		}
+		return []*otpParams{p}, nil
+	}
+
+	secret, err := format.DecodeBase32Secret(input)
+	if err != nil {
+		return nil, err
+	}
+	return []*otpParams{{
+		Type:      otpType,
+		Secret:    secret,
+		Issuer:    otpIssuer,
+		Account:   otpAccount,
+		Algorithm: strings.ToUpper(otpAlg),
+		Digits:    digits,
+		Period:    period,
+		Counter:   counter,
+	}}, nil
+}
+
+// parseOTPURI parses an otpauth:// URI in the Key Uri Format
+func parseOTPURI(uri string) (*otpParams, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse otpauth URI")
+	}
+	q := u.Query()
+
+	secret, err := format.DecodeBase32Secret(q.Get("secret"))
+	if err != nil {
+		return nil, err
+	}
+	p := &otpParams{
+		Type:      strings.ToLower(u.Host),
+		Secret:    secret,
+		Issuer:    q.Get("issuer"),
+		Algorithm: "SHA1",
+		Digits:    6,
+		Period:    30,
+		Counter:   counter,
+	}
+	if p.Type != "totp" && p.Type != "hotp" {
+		return nil, errors.New("recognize OTP type " + u.Host)
+	}
+
+	label := strings.TrimPrefix(u.Path, "/")
+	if idx := strings.Index(label, ":"); idx >= 0 {
+		if p.Issuer == "" {
+			p.Issuer = label[:idx]
+		}
+		label = label[idx+1:]
+	}
+	p.Account = strings.TrimSpace(label)
+
+	if alg := q.Get("algorithm"); alg != "" {
+		p.Algorithm = strings.ToUpper(alg)
+	}
+	for name, field := range map[string]*int{"digits": &p.Digits, "period": &p.Period} {
+		if value := q.Get(name); value != "" {
+			if *field, err = strconv.Atoi(value); err != nil {
+				return nil, errors.Wrap(err, "parse otpauth "+name)
+			}
+		}
+	}
+	if value := q.Get("counter"); value != "" {
+		if p.Counter, err = strconv.ParseUint(value, 10, 64); err != nil {
+			return nil, errors.Wrap(err, "parse otpauth counter")
+		}
+	}
+
+	return p, nil
+}
+
+// marshalOTPURI creates an otpauth:// URI in the Key Uri Format
+func marshalOTPURI(p *otpParams) string {
+	q := url.Values{}
+	q.Set("secret", base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(p.Secret))
+	if p.Issuer != "" {
+		q.Set("issuer", p.Issuer)
+	}
+	q.Set("algorithm", p.Algorithm)
+	q.Set("digits", strconv.Itoa(p.Digits))
+	if p.Type == "hotp" {
+		q.Set("counter", strconv.FormatUint(p.Counter, 10))
+	} else {
+		q.Set("period", strconv.Itoa(p.Period))
+	}
+
+	u := url.URL{Scheme: "otpauth", Host: p.Type, Path: "/" + otpLabel(p), RawQuery: q.Encode()}
+	return u.String()
+}
+
+// otpLabel joins the issuer and account name of an OTP generator
+func otpLabel(p *otpParams) string {
+	if p.Issuer == "" {
+		return p.Account
+	}
+	return p.Issuer + ":" + p.Account
+}
+
+// describeOTP lists the parameters of an OTP generator
+func describeOTP(p *otpParams) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Type: %s\n", p.Type)
+	fmt.Fprintf(&b, "Issuer: %s\n", p.Issuer)
+	fmt.Fprintf(&b, "Account: %s\n", p.Account)
+	fmt.Fprintf(&b, "Secret: %s\n", base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(p.Secret))
+	fmt.Fprintf(&b, "Algorithm: %s\n", p.Algorithm)
+	fmt.Fprintf(&b, "Digits: %d\n", p.Digits)
+	if p.Type == "hotp" {
+		fmt.Fprintf(&b, "Counter: %d\n", p.Counter)
+	} else {
+		fmt.Fprintf(&b, "Period: %d\n", p.Period)
+	}
+	fmt.Fprintf(&b, "URI: %s", marshalOTPURI(p))
+	return b.String()
+}
+
+// otpCounter gets the moving factor of an OTP generator
+func otpCounter(p *otpParams) (uint64, error) {
+	if p.Type == "hotp" {
+		return p.Counter, nil
+	}
+	if p.Period <= 0 {
+		return 0, errors.New("validate TOTP period")
+	}
+
+	now := time.Now()
+	if unixTime != 0 {
+		now = time.Unix(unixTime, 0)
+	}
+	return uint64(now.Add(timeOffset).Unix()) / uint64(p.Period), nil
+}
+
+// hotp computes the HOTP value of [c] as in RFC 4226
+func hotp(p *otpParams, c uint64) (string, error) {
+	var h func() hash.Hash
+	switch p.Algorithm {
+	case "SHA1":
+		h = sha1.New
+	case "SHA256":
+		h = sha256.New
+	case "SHA512":
+		h = sha512.New
+	default:
+		return "", errors.New("recognize OTP algorithm " + p.Algorithm)
+	}
+	if p.Digits < 6 || p.Digits > 8 {
+		return "", errors.New("validate OTP digits: 6 to 8 digits are supported")
+	}
+
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, c)
+	mac := hmac.New(h, p.Secret)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	// dynamic truncation
+	offset := sum[len(sum)-1] & 0xf
+	code := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	mod := uint32(1)
+	for i := 0; i < p.Digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", p.Digits, code%mod), nil
+}
+
+// generateOTP generates the current code of an OTP generator
+func generateOTP(p *otpParams) (string, error) {
+	c, err := otpCounter(p)
+	if err != nil {
+		return "", err
+	}
+	return hotp(p, c)
+}
+
+// verifyOTP verifies [code] within the window, reporting the drift of the matching counter
+func verifyOTP(p *otpParams, code string) (string, error) {
+	c, err := otpCounter(p)
+	if err != nil {
+		return "", err
+	}
+
+	from := -window
+	if p.Type == "hotp" {
+		from = 0
+	}
+	for drift := from; drift <= window; drift++ {
+		if drift < 0 && c < uint64(-drift) {
+			continue
+		}
+		expected, err := hotp(p, c+uint64(drift))
+		if err != nil {
+			return "", err
+		}
+		if hmac.Equal([]byte(expected), []byte(code)) {
+			return fmt.Sprintf("Code verified, drift: %d", drift), nil
+		}
+	}
+	return "", errors.New("verify the code")
+}
+
+// parseMigrationURI decodes an otpauth-migration:// URI exported by Google Authenticator
+func parseMigrationURI(uri string) ([]*otpParams, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse migration URI")
+	}
+	// unescaped '+' in the data parameter is decoded as a space
+	data := strings.ReplaceAll(u.Query().Get("data"), " ", "+")
+	payload, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "decode migration payload")
+	}
+
+	var params []*otpParams
+	err = walkProtobuf(payload, func(field int, value uint64, data []byte) error {
+		// MigrationPayload.otp_parameters
+		if field != 1 || data == nil {
+			return nil
+		}
+		p, err := parseMigrationEntry(data)
+		if err != nil {
+			return err
+		}
+		params = append(params, p)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(params) == 0 {
+		return nil, errors.New("find OTP parameters in migration payload")
+	}
+
+	return params, nil
+}
+
+// parseMigrationEntry decodes an OtpParameters message in a migration payload
+func parseMigrationEntry(entry []byte) (*otpParams, error) {
+	p := &otpParams{Type: "totp", Algorithm: "SHA1", Digits: 6, Period: 30}
+	err := walkProtobuf(entry, func(field int, value uint64, data []byte) error {
+		switch field {
+		case 1:
+			p.Secret = data
+		case 2:
+			p.Account = string(data)
+			if idx := strings.Index(p.Account, ":"); idx >= 0 {
+				p.Account = p.Account[idx+1:]
+			}
+		case 3:
+			p.Issuer = string(data)
+		case 4:
+			switch value {
+			case 2:
+				p.Algorithm = "SHA256"
+			case 3:
+				p.Algorithm = "SHA512"
+			case 4:
+				p.Algorithm = "MD5"
+			}
+		case 5:
+			if value == 2 {
+				p.Digits = 8
+			}
+		case 6:
+			if value == 1 {
+				p.Type = "hotp"
+			}
+		case 7:
+			p.Counter = value
+		}
+		return nil
+	})
+
+	return p, err
+}
+
+// walkProtobuf calls [visit] on each varint and length-delimited field of a protobuf message
+func walkProtobuf(msg []byte, visit func(field int, value uint64, data []byte) error) error {
+	for len(msg) > 0 {
+		tag, n := binary.Uvarint(msg)
+		if n <= 0 {
+			return errors.New("parse protobuf tag")
+		}
+		msg = msg[n:]
+
+		field := int(tag >> 3)
+		var err error
+		switch tag & 7 {
+		case 0:
+			value, n := binary.Uvarint(msg)
+			if n <= 0 {
+				return errors.New("parse protobuf varint")
+			}
+			msg = msg[n:]
+			err = visit(field, value, nil)
+		case 1, 5:
+			size := 8
+			if tag&7 == 5 {
+				size = 4
+			}
+			if len(msg) < size {
+				return errors.New("parse protobuf fixed field")
+			}
+			msg = msg[size:]
+		case 2:
+			length, n := binary.Uvarint(msg)
+			if n <= 0 || uint64(len(msg)-n) < length {
+				return errors.New("parse protobuf length-delimited field")
+			}
+			data := msg[n : n+int(length)]
+			msg = msg[n+int(length):]
+			err = visit(field, 0, data)
+		default:
+			return errors.New("parse protobuf wire type")
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func init() {
+	encCmd.AddCommand(NewOtpCmd())
+}
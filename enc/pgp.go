@@ -0,0 +1,490 @@
+/*
+Copyright © 2021 SignorMercurio
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package enc
+
+import (
+	"bytes"
+	"crypto"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/clearsign"
+	pgperrors "github.com/ProtonMail/go-crypto/openpgp/errors"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/SignorMercurio/attrezzi/cmd"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var (
+	pgpGen       bool
+	pgpExport    bool
+	pgpClearsign bool
+	pgpVerify    bool
+	pgpDump      bool
+	pgpName      string
+	pgpEmail     string
+	pgpComment   string
+	pgpBits      int
+	pgpPubPaths  []string
+	pgpPrivPath  string
+)
+
+// pgpAlgoNames maps OpenPGP public key algorithms to their names
+var pgpAlgoNames = map[packet.PublicKeyAlgorithm]string{
+	packet.PubKeyAlgoRSA:            "RSA",
+	packet.PubKeyAlgoRSAEncryptOnly: "RSA (encrypt only)",
+	packet.PubKeyAlgoRSASignOnly:    "RSA (sign only)",
+	packet.PubKeyAlgoElGamal:        "ElGamal",
+	packet.PubKeyAlgoDSA:            "DSA",
+	packet.PubKeyAlgoECDH:           "ECDH",
+	packet.PubKeyAlgoECDSA:          "ECDSA",
+}
+
+// pgpCipherNames maps OpenPGP symmetric ciphers to their names
+var pgpCipherNames = map[packet.CipherFunction]string{
+	packet.Cipher3DES:   "3DES",
+	packet.CipherCAST5:  "CAST5",
+	packet.CipherAES128: "AES-128",
+	packet.CipherAES192: "AES-192",
+	packet.CipherAES256: "AES-256",
+}
+
+// NewPgpCmd represents the pgp command
+func NewPgpCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "pgp",
+		Short: "OpenPGP-related operation",
+		Long: `OpenPGP-related operation
+Keys and messages are ASCII-armored. Generated secret keys are not protected by a passphrase.
+Example:
+	att enc pgp -g --name Alice --email alice@example.com -o alice.asc
+	att enc -i alice.asc pgp --export -o alice.pub.asc
+	att enc -i msg.txt pgp -e --pub alice.pub.asc --pub bob.pub.asc
+	att enc -i msg.txt pgp -e --pass secret
+	att enc -i msg.asc pgp -d --priv alice.asc
+	att enc -i msg.txt pgp --clearsign --priv alice.asc
+	att enc -i signed.asc pgp -v --pub alice.pub.asc
+	att enc -i msg.asc pgp --dump`,
+		Annotations: map[string]string{noInput: ""},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var buf bytes.Buffer
+			var err error
+
+			if !pgpGen {
+				if inputBytes, err = getInput(); err != nil {
+					return err
+				}
+			}
+
+			switch {
+			case pgpGen:
+				err = pgpGenerate(&buf)
+			case pgpExport:
+				err = pgpExportPublic(&buf)
+			case enc:
+				err = pgpEncrypt(&buf)
+			case dec:
+				err = pgpDecrypt(&buf)
+			case pgpClearsign:
+				err = pgpSign(&buf)
+			case pgpVerify:
+				err = pgpCheck(&buf)
+			case pgpDump:
+				err = pgpDumpPackets(&buf)
+			default:
+				NoActionSpecified()
+			}
+			if err != nil {
+				return err
+			}
+
+			Echo(buf.String())
+			return nil
+		},
+	}
+	cmd.Flags().BoolVarP(&pgpGen, "gen", "g", false, "Generate an RSA secret key")
+	cmd.Flags().BoolVar(&pgpExport, "export", false, "Export the public key of the input secret key")
+	cmd.Flags().BoolVarP(&enc, "encrypt", "e", false, "Encrypt to the recipients, or symmetrically with the passphrase")
+	cmd.Flags().BoolVarP(&dec, "decrypt", "d", false, "Decrypt with the secret key or the passphrase")
+	cmd.Flags().BoolVar(&pgpClearsign, "clearsign", false, "Clearsign the input")
+	cmd.Flags().BoolVarP(&pgpVerify, "verify", "v", false, "Verify a clearsigned message")
+	cmd.Flags().BoolVar(&pgpDump, "dump", false, "Dump the packets of an OpenPGP message or key")
+	cmd.Flags().StringVar(&pgpName, "name", "", "Name in the user ID of the generated key")
+	cmd.Flags().StringVar(&pgpEmail, "email", "", "Email in the user ID of the generated key")
+	cmd.Flags().StringVar(&pgpComment, "comment", "", "Comment in the user ID of the generated key")
+	cmd.Flags().IntVar(&pgpBits, "bits", 3072, "RSA key size of the generated key")
+	cmd.Flags().StringArrayVar(&pgpPubPaths, "pub", nil, "Public key file of a recipient / signer, can be repeated")
+	cmd.Flags().StringVar(&pgpPrivPath, "priv", "", "Secret key file to decrypt / sign with")
+	cmd.Flags().StringVar(&passphrase, "pass", "", "Passphrase for symmetric encryption or of the secret key")
+
+	return cmd
+}
+
+// readPGPKeys reads armored or binary keys from [path]
+func readPGPKeys(path string) (openpgp.EntityList, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "read key file")
+	}
+
+	var keys openpgp.EntityList
+	if bytes.Contains(data, []byte("-----BEGIN PGP")) {
+		keys, err = openpgp.ReadArmoredKeyRing(bytes.NewReader(data))
+	} else {
+		keys, err = openpgp.ReadKeyRing(bytes.NewReader(data))
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "parse OpenPGP key "+path)
+	}
+	return keys, nil
+}
+
+// readPGPSecretKey reads the first secret key in [path], decrypting it with the passphrase if needed
+func readPGPSecretKey(path string) (*openpgp.Entity, error) {
+	entities, err := readPGPSecretKeys(path)
+	if err != nil {
+		return nil, err
+	}
+	return entities[0], nil
+}
+
+// readPGPSecretKeys reads every secret key in [path], decrypting them with the passphrase if needed
+func readPGPSecretKeys(path string) (openpgp.EntityList, error) {
+	keys, err := readPGPKeys(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var entities openpgp.EntityList
+	for _, entity := range keys {
+		if entity.PrivateKey == nil {
+			continue
+		}
+		privs := []*packet.PrivateKey{entity.PrivateKey}
+		for _, subkey := range entity.Subkeys {
+			if subkey.PrivateKey != nil {
+				privs = append(privs, subkey.PrivateKey)
+			}
+		}
+		for _, priv := range privs {
+			if priv.Encrypted {
+				if err := priv.Decrypt([]byte(passphrase)); err != nil {
+					return nil, errors.Wrap(err, "decrypt secret key")
+				}
+			}
+		}
+		entities = append(entities, entity)
+	}
+	if len(entities) == 0 {
+		return nil, errors.New("find secret key in " + path)
+	}
+	return entities, nil
+}
+
+// readPGPRecipients reads the public keys of all recipients
+func readPGPRecipients() (openpgp.EntityList, error) {
+	var recipients openpgp.EntityList
+	for _, path := range pgpPubPaths {
+		keys, err := readPGPKeys(path)
+		if err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, keys...)
+	}
+	return recipients, nil
+}
+
+// armorInput returns the body of armored input, or the input itself if it is binary
+func armorInput() (io.Reader, error) {
+	if !bytes.Contains(inputBytes, []byte("-----BEGIN PGP")) {
+		return bytes.NewReader(inputBytes), nil
+	}
+	block, err := armor.Decode(bytes.NewReader(inputBytes))
+	if err != nil {
+		return nil, errors.Wrap(err, "decode armor")
+	}
+	return block.Body, nil
+}
+
+// identityOf returns the primary user ID of [e]
+func identityOf(e *openpgp.Entity) string {
+	for name, identity := range e.Identities {
+		if identity.SelfSignature != nil && identity.SelfSignature.IsPrimaryId != nil && *identity.SelfSignature.IsPrimaryId {
+			return name
+		}
+	}
+	for name := range e.Identities {
+		return name
+	}
+	return ""
+}
+
+// pgpGenerate generates an armored secret key
+func pgpGenerate(w io.Writer) error {
+	entity, err := openpgp.NewEntity(pgpName, pgpComment, pgpEmail, &packet.Config{
+		RSABits:       pgpBits,
+		DefaultHash:   crypto.SHA256,
+		DefaultCipher: packet.CipherAES256,
+	})
+	if err != nil {
+		return errors.Wrap(err, "generate OpenPGP key")
+	}
+
+	armored, err := armor.Encode(w, openpgp.PrivateKeyType, nil)
+	if err != nil {
+		return errors.Wrap(err, "encode armor")
+	}
+	if err := entity.SerializePrivate(armored, nil); err != nil {
+		return errors.Wrap(err, "serialize secret key")
+	}
+	return armored.Close()
+}
+
+// pgpExportPublic exports the armored public key of the input secret key
+func pgpExportPublic(w io.Writer) error {
+	keys, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(inputBytes))
+	if err != nil {
+		return errors.Wrap(err, "parse OpenPGP key")
+	}
+
+	armored, err := armor.Encode(w, openpgp.PublicKeyType, nil)
+	if err != nil {
+		return errors.Wrap(err, "encode armor")
+	}
+	for _, entity := range keys {
+		if err := entity.Serialize(armored); err != nil {
+			return errors.Wrap(err, "serialize public key")
+		}
+	}
+	return armored.Close()
+}
+
+// pgpEncrypt encrypts the input to the recipients, signing it if a secret key is given
+func pgpEncrypt(w io.Writer) error {
+	armored, err := armor.Encode(w, "PGP MESSAGE", nil)
+	if err != nil {
+		return errors.Wrap(err, "encode armor")
+	}
+
+	var plain io.WriteCloser
+	if len(pgpPubPaths) == 0 {
+		if passphrase == "" {
+			return errors.New("find any recipient. Please specify either --pub or --pass")
+		}
+		plain, err = openpgp.SymmetricallyEncrypt(armored, []byte(passphrase), nil, nil)
+	} else {
+		var recipients openpgp.EntityList
+		var signer *openpgp.Entity
+		if recipients, err = readPGPRecipients(); err != nil {
+			return err
+		}
+		if pgpPrivPath != "" {
+			if signer, err = readPGPSecretKey(pgpPrivPath); err != nil {
+				return err
+			}
+		}
+		plain, err = openpgp.Encrypt(armored, recipients, signer, nil, nil)
+	}
+	if err != nil {
+		return errors.Wrap(err, "encrypt OpenPGP message")
+	}
+
+	if _, err := plain.Write(inputBytes); err != nil {
+		return errors.Wrap(err, "encrypt OpenPGP message")
+	}
+	if err := plain.Close(); err != nil {
+		return errors.Wrap(err, "encrypt OpenPGP message")
+	}
+	return armored.Close()
+}
+
+// pgpDecrypt decrypts the input, verifying its signature if the signer is known
+func pgpDecrypt(w io.Writer) error {
+	keyring, err := readPGPRecipients()
+	if err != nil {
+		return err
+	}
+	if pgpPrivPath != "" {
+		entities, err := readPGPSecretKeys(pgpPrivPath)
+		if err != nil {
+			return err
+		}
+		keyring = append(keyring, entities...)
+	}
+
+	body, err := armorInput()
+	if err != nil {
+		return err
+	}
+	prompted := false
+	prompt := func(keys []openpgp.Key, symmetric bool) ([]byte, error) {
+		if !symmetric || prompted || passphrase == "" {
+			return nil, errors.New("find the key to decrypt with")
+		}
+		prompted = true
+		return []byte(passphrase), nil
+	}
+
+	md, err := openpgp.ReadMessage(body, keyring, prompt, nil)
+	if err != nil {
+		return errors.Wrap(err, "decrypt OpenPGP message")
+	}
+	if _, err := io.Copy(w, md.UnverifiedBody); err != nil {
+		return errors.Wrap(err, "decrypt OpenPGP message")
+	}
+	if md.IsSigned && md.SignedBy == nil {
+		cmd.Log.Warnf("Signature not verified: signer key ID %016X is unknown. Please specify the public key of the signer with --pub", md.SignedByKeyId)
+	}
+	if md.IsSigned && md.SignedBy != nil && md.SignatureError != nil {
+		return errors.Wrap(md.SignatureError, "verify signature")
+	}
+	return nil
+}
+
+// pgpSign clearsigns the input
+func pgpSign(w io.Writer) error {
+	if pgpPrivPath == "" {
+		return errors.New("find secret key. Please specify --priv")
+	}
+	entity, err := readPGPSecretKey(pgpPrivPath)
+	if err != nil {
+		return err
+	}
+
+	plain, err := clearsign.Encode(w, entity.PrivateKey, nil)
+	if err != nil {
+		return errors.Wrap(err, "clearsign")
+	}
+	if _, err := plain.Write(inputBytes); err != nil {
+		return errors.Wrap(err, "clearsign")
+	}
+	return plain.Close()
+}
+
+// pgpCheck verifies a clearsigned input
+func pgpCheck(w io.Writer) error {
+	keyring, err := readPGPRecipients()
+	if err != nil {
+		return err
+	}
+
+	block, _ := clearsign.Decode(inputBytes)
+	if block == nil {
+		return errors.New("find clearsigned message")
+	}
+	signer, err := openpgp.CheckDetachedSignature(keyring, bytes.NewReader(block.Bytes), block.ArmoredSignature.Body, nil)
+	if err != nil {
+		return errors.Wrap(err, "verify signature")
+	}
+
+	fmt.Fprintf(w, "Good signature from %s (key ID %s)", identityOf(signer), signer.PrimaryKey.KeyIdString())
+	return nil
+}
+
+// pgpDumpPackets lists the packets of the input
+func pgpDumpPackets(w io.Writer) error {
+	body, err := armorInput()
+	if err != nil {
+		return err
+	}
+	var lines []string
+	if err := dumpPackets(body, 0, &lines); err != nil {
+		return err
+	}
+	if len(lines) == 0 {
+		return errors.New("find any OpenPGP packet")
+	}
+	_, err = io.WriteString(w, strings.Join(lines, "\n"))
+	return err
+}
+
+// dumpPackets describes the packets in [r], recursing into compressed data
+func dumpPackets(r io.Reader, depth int, lines *[]string) error {
+	indent := strings.Repeat("  ", depth)
+	for {
+		p, err := packet.Read(r)
+		if err == io.EOF {
+			return nil
+		}
+		if _, unknown := err.(pgperrors.UnknownPacketTypeError); unknown {
+			*lines = append(*lines, indent+err.Error())
+			continue
+		}
+		if err != nil {
+			return errors.Wrap(err, "parse OpenPGP packet")
+		}
+
+		var line string
+		switch p := p.(type) {
+		case *packet.EncryptedKey:
+			line = fmt.Sprintf("Public-Key Encrypted Session Key: key ID %016X, %s", p.KeyId, pgpAlgoNames[p.Algo])
+		case *packet.SymmetricKeyEncrypted:
+			line = fmt.Sprintf("Symmetric-Key Encrypted Session Key: %s", pgpCipherNames[p.CipherFunc])
+		case *packet.Signature:
+			line = fmt.Sprintf("Signature: type 0x%02x, %s, %s, created %s", p.SigType, pgpAlgoNames[p.PubKeyAlgo], p.Hash, p.CreationTime.UTC().Format("2006-01-02T15:04:05Z"))
+			if p.IssuerKeyId != nil {
+				line += fmt.Sprintf(", issuer %016X", *p.IssuerKeyId)
+			}
+		case *packet.OnePassSignature:
+			line = fmt.Sprintf("One-Pass Signature: type 0x%02x, %s, %s, key ID %016X", p.SigType, pgpAlgoNames[p.PubKeyAlgo], p.Hash, p.KeyId)
+		case *packet.PrivateKey:
+			kind := "Secret Key"
+			if p.IsSubkey {
+				kind = "Secret Subkey"
+			}
+			line = fmt.Sprintf("%s: key ID %s, %s, created %s, encrypted %t", kind, p.KeyIdString(), pgpAlgoNames[p.PubKeyAlgo], p.CreationTime.UTC().Format("2006-01-02T15:04:05Z"), p.Encrypted)
+		case *packet.PublicKey:
+			kind := "Public Key"
+			if p.IsSubkey {
+				kind = "Public Subkey"
+			}
+			line = fmt.Sprintf("%s: key ID %s, %s, created %s", kind, p.KeyIdString(), pgpAlgoNames[p.PubKeyAlgo], p.CreationTime.UTC().Format("2006-01-02T15:04:05Z"))
+			if bits, err := p.BitLength(); err == nil {
+				line += fmt.Sprintf(", %d bits", bits)
+			}
+		case *packet.UserId:
+			line = fmt.Sprintf("User ID: %s", p.Id)
+		case *packet.UserAttribute:
+			line = fmt.Sprintf("User Attribute: %d images", len(p.ImageData()))
+		case *packet.SymmetricallyEncrypted:
+			// the encrypted data runs to the end of the message
+			*lines = append(*lines, indent+fmt.Sprintf("Symmetrically Encrypted Data: integrity protected %t", p.MDC))
+			return nil
+		case *packet.Compressed:
+			*lines = append(*lines, indent+"Compressed Data:")
+			if err := dumpPackets(p.Body, depth+1, lines); err != nil {
+				return err
+			}
+			continue
+		case *packet.LiteralData:
+			size, _ := io.Copy(ioutil.Discard, p.Body)
+			line = fmt.Sprintf("Literal Data: file name %q, binary %t, %d bytes", p.FileName, p.IsBinary, size)
+		default:
+			line = fmt.Sprintf("%T", p)
+		}
+		*lines = append(*lines, indent+line)
+	}
+}
+
+func init() {
+	encCmd.AddCommand(NewPgpCmd())
+}
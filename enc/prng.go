@@ -0,0 +1,469 @@
+/*
+Copyright © 2021 SignorMercurio
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package enc
+
+import (
+	"fmt"
+	"math/big"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var (
+	prngAlg      string
+	predictCount int
+	seedMin      int64
+	seedMax      int64
+	lcgA         string
+	lcgC         string
+	lcgM         string
+	goMethod     string
+)
+
+const (
+	mtN = 624
+	mtM = 397
+
+	javaMultiplier = 0x5DEECE66D
+	javaAddend     = 0xB
+	javaMask       = 1<<48 - 1
+)
+
+// NewPrngCmd represents the prng command
+func NewPrngCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "prng",
+		Short: "PRNG state recovery and prediction",
+		Long: `PRNG state recovery and prediction
+Input is consecutive observed outputs in decimal, separated by spaces, commas or newlines.
+	mt19937: 624 32-bit outputs, e.g. Python random.getrandbits(32)
+	java:    2 java.util.Random nextInt() outputs
+	glibc:   rand() outputs, searching the seed in --seed-min ~ --seed-max
+	lcg:     outputs of x = (a * x + c) mod m, missing parameters are recovered from 6 or more outputs
+	go:      math/rand outputs of --go-method, searching the seed in --seed-min ~ --seed-max
+Example:
+	att enc -i outputs.txt prng -a mt19937 -n 5
+	echo "-1155869325 431529176" | att enc prng -a java
+	echo "1804289383 846930886" | att enc prng -a glibc --seed-min 0 --seed-max 100
+	att enc -i lcg.txt prng -a lcg --lcg-m 2147483648`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			observed, err := parseObserved(string(inputBytes))
+			if err != nil {
+				return err
+			}
+			if len(observed) == 0 {
+				return errors.New("find any observed output")
+			}
+
+			var params []string
+			var next []string
+			switch prngAlg {
+			case "mt19937":
+				next, err = predictMT19937(observed)
+			case "java":
+				params, next, err = predictJava(observed)
+			case "glibc":
+				params, next, err = predictGlibc(observed)
+			case "lcg":
+				params, next, err = predictLCG(observed)
+			case "go":
+				params, next, err = predictGo(observed)
+			default:
+				err = errors.New("recognize PRNG " + prngAlg)
+			}
+			if err != nil {
+				return err
+			}
+
+			Echo(strings.Join(append(params, "Next:\n"+strings.Join(next, "\n")), "\n"))
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&prngAlg, "algorithm", "a", "mt19937", "PRNG: mt19937 / java / glibc / lcg / go")
+	cmd.Flags().IntVarP(&predictCount, "count", "n", 10, "Number of outputs to predict")
+	cmd.Flags().Int64Var(&seedMin, "seed-min", 0, "Minimum seed to search")
+	cmd.Flags().Int64Var(&seedMax, "seed-max", 1<<20, "Maximum seed to search")
+	cmd.Flags().StringVar(&lcgA, "lcg-a", "", "Multiplier of the LCG, recovered if empty")
+	cmd.Flags().StringVar(&lcgC, "lcg-c", "", "Increment of the LCG, recovered if empty")
+	cmd.Flags().StringVar(&lcgM, "lcg-m", "", "Modulus of the LCG, recovered if empty")
+	cmd.Flags().StringVar(&goMethod, "go-method", "int63", "math/rand method producing the outputs: int63 / uint32 / int31")
+
+	return cmd
+}
+
+// parseObserved parses the observed outputs
+func parseObserved(input string) ([]*big.Int, error) {
+	fields := strings.FieldsFunc(input, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\n' || r == '\r' || r == '\t'
+	})
+
+	observed := make([]*big.Int, len(fields))
+	for i, field := range fields {
+		n, ok := new(big.Int).SetString(field, 10)
+		if !ok {
+			return nil, errors.New("parse observed output " + field)
+		}
+		observed[i] = n
+	}
+	return observed, nil
+}
+
+// toUint32s converts the observed outputs to 32-bit words
+func toUint32s(observed []*big.Int) ([]uint32, error) {
+	words := make([]uint32, len(observed))
+	for i, n := range observed {
+		if !n.IsInt64() || n.Int64() < -1<<31 || n.Int64() > 1<<32-1 {
+			return nil, errors.New("validate observed output " + n.String() + ": it should fit in 32 bits")
+		}
+		words[i] = uint32(n.Int64())
+	}
+	return words, nil
+}
+
+// formatUint32s formats predictions as unsigned or signed integers
+func formatUint32s(words []uint32, signed bool) []string {
+	result := make([]string, len(words))
+	for i, w := range words {
+		if signed {
+			result[i] = strconv.Itoa(int(int32(w)))
+		} else {
+			result[i] = strconv.FormatUint(uint64(w), 10)
+		}
+	}
+	return result
+}
+
+// mismatch reports the first observed output differing from the generated ones
+func mismatch(observed, generated []uint32) error {
+	for i := range observed {
+		if observed[i] != generated[i] {
+			return errors.New("match observed output " + strconv.Itoa(i) + ": the outputs are not from this PRNG")
+		}
+	}
+	return nil
+}
+
+// untemperMT19937 inverts the MT19937 tempering transform
+func untemperMT19937(y uint32) uint32 {
+	y ^= y >> 18
+	y ^= y << 15 & 0xefc60000
+	// y ^= y << 7 & 0x9d2c5680 recovers 7 bits per round
+	x := y
+	for i := 0; i < 4; i++ {
+		x = y ^ x<<7&0x9d2c5680
+	}
+	y = x
+	// y ^= y >> 11 recovers 11 bits per round
+	x = y
+	for i := 0; i < 2; i++ {
+		x = y ^ x>>11
+	}
+	return x
+}
+
+// temperMT19937 applies the MT19937 tempering transform
+func temperMT19937(y uint32) uint32 {
+	y ^= y >> 11
+	y ^= y << 7 & 0x9d2c5680
+	y ^= y << 15 & 0xefc60000
+	y ^= y >> 18
+	return y
+}
+
+// twistMT19937 generates the next 624 words of the MT19937 state
+func twistMT19937(state []uint32) {
+	for i := 0; i < mtN; i++ {
+		y := state[i]&0x80000000 | state[(i+1)%mtN]&0x7fffffff
+		next := state[(i+mtM)%mtN] ^ y>>1
+		if y&1 != 0 {
+			next ^= 0x9908b0df
+		}
+		state[i] = next
+	}
+}
+
+// predictMT19937 clones MT19937 from 624 outputs, checking the rest of the observed outputs
+func predictMT19937(observed []*big.Int) ([]string, error) {
+	words, err := toUint32s(observed)
+	if err != nil {
+		return nil, err
+	}
+	if len(words) < mtN {
+		return nil, errors.New("recover MT19937 state: " + strconv.Itoa(mtN) + " outputs are required, got " + strconv.Itoa(len(words)))
+	}
+
+	state := make([]uint32, mtN)
+	for i := range state {
+		state[i] = untemperMT19937(words[i])
+	}
+
+	extra := len(words) - mtN
+	generated := make([]uint32, 0, extra+predictCount)
+	for len(generated) < extra+predictCount {
+		twistMT19937(state)
+		for _, s := range state {
+			generated = append(generated, temperMT19937(s))
+		}
+	}
+	if err := mismatch(words[mtN:], generated); err != nil {
+		return nil, err
+	}
+
+	return formatUint32s(generated[extra:extra+predictCount], false), nil
+}
+
+// javaNext advances a java.util.Random state and returns next(32)
+func javaNext(seed *uint64) uint32 {
+	*seed = (*seed*javaMultiplier + javaAddend) & javaMask
+	return uint32(*seed >> 16)
+}
+
+// predictJava recovers the java.util.Random state from nextInt() outputs
+func predictJava(observed []*big.Int) ([]string, []string, error) {
+	words, err := toUint32s(observed)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(words) < 2 {
+		return nil, nil, errors.New("recover java.util.Random state: 2 outputs are required")
+	}
+
+	// the first output gives the upper 32 bits of the 48-bit state
+	for low := uint64(0); low < 1<<16; low++ {
+		first := uint64(words[0])<<16 | low
+		seed := first
+		generated := []uint32{words[0]}
+		for len(generated) < len(words) {
+			generated = append(generated, javaNext(&seed))
+		}
+		if mismatch(words, generated) != nil {
+			continue
+		}
+
+		// step back once to the state before the first output, then undo the scrambling
+		inverse := new(big.Int).ModInverse(big.NewInt(javaMultiplier), big.NewInt(javaMask+1)).Uint64()
+		initial := ((first - javaAddend) * inverse) & javaMask
+		params := []string{fmt.Sprintf("Seed: %d", int64(initial^javaMultiplier)<<16>>16)}
+
+		next := make([]uint32, predictCount)
+		for i := range next {
+			next[i] = javaNext(&seed)
+		}
+		return params, formatUint32s(next, true), nil
+	}
+
+	return nil, nil, errors.New("recover java.util.Random state: the outputs are not from nextInt()")
+}
+
+// glibcRand implements glibc random() with the default TYPE_3 state
+type glibcRand struct {
+	r []uint32
+	i int
+}
+
+// newGlibcRand seeds glibc random() as srand() does
+func newGlibcRand(seed uint32) *glibcRand {
+	if seed == 0 {
+		seed = 1
+	}
+	r := make([]uint32, 34, 64)
+	r[0] = seed
+	for i := 1; i < 31; i++ {
+		word := int64(int32(r[i-1]))
+		hi, lo := word/127773, word%127773
+		word = 16807*lo - 2836*hi
+		if word < 0 {
+			word += 2147483647
+		}
+		r[i] = uint32(word)
+	}
+	for i := 31; i < 34; i++ {
+		r[i] = r[i-31]
+	}
+
+	g := &glibcRand{r: r[3:]}
+	for i := 0; i < 310; i++ {
+		g.next()
+	}
+	return g
+}
+
+// next returns the next output of glibc rand()
+func (g *glibcRand) next() uint32 {
+	v := g.r[len(g.r)-31] + g.r[len(g.r)-3]
+	g.r = append(g.r[1:], v)
+	return v >> 1
+}
+
+// predictGlibc searches the seed of glibc rand() in the seed range
+func predictGlibc(observed []*big.Int) ([]string, []string, error) {
+	words, err := toUint32s(observed)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for seed := seedMin; seed <= seedMax; seed++ {
+		g := newGlibcRand(uint32(seed))
+		generated := make([]uint32, len(words))
+		for i := range generated {
+			generated[i] = g.next()
+		}
+		if mismatch(words, generated) != nil {
+			continue
+		}
+
+		next := make([]uint32, predictCount)
+		for i := range next {
+			next[i] = g.next()
+		}
+		return []string{fmt.Sprintf("Seed: %d", uint32(seed))}, formatUint32s(next, false), nil
+	}
+
+	return nil, nil, errors.New("find the seed in the seed range")
+}
+
+// predictGo searches the seed of math/rand in the seed range
+func predictGo(observed []*big.Int) ([]string, []string, error) {
+	var method func(r *rand.Rand) int64
+	switch goMethod {
+	case "int63":
+		method = func(r *rand.Rand) int64 { return r.Int63() }
+	case "uint32":
+		method = func(r *rand.Rand) int64 { return int64(r.Uint32()) }
+	case "int31":
+		method = func(r *rand.Rand) int64 { return int64(r.Int31()) }
+	default:
+		return nil, nil, errors.New("recognize math/rand method " + goMethod)
+	}
+
+	for seed := seedMin; seed <= seedMax; seed++ {
+		r := rand.New(rand.NewSource(seed))
+		matched := true
+		for _, o := range observed {
+			if !o.IsInt64() || method(r) != o.Int64() {
+				matched = false
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+
+		next := make([]string, predictCount)
+		for i := range next {
+			next[i] = strconv.FormatInt(method(r), 10)
+		}
+		return []string{fmt.Sprintf("Seed: %d", seed)}, next, nil
+	}
+
+	return nil, nil, errors.New("find the seed in the seed range")
+}
+
+// parseLCGParam parses an LCG parameter, returning nil if it is not given
+func parseLCGParam(name, value string) (*big.Int, error) {
+	if value == "" {
+		return nil, nil
+	}
+	n, ok := new(big.Int).SetString(value, 0)
+	if !ok {
+		return nil, errors.New("parse LCG " + name + " " + value)
+	}
+	return n, nil
+}
+
+// predictLCG recovers the missing parameters of an LCG and predicts its outputs
+func predictLCG(x []*big.Int) ([]string, []string, error) {
+	a, err := parseLCGParam("multiplier", lcgA)
+	if err != nil {
+		return nil, nil, err
+	}
+	c, err := parseLCGParam("increment", lcgC)
+	if err != nil {
+		return nil, nil, err
+	}
+	m, err := parseLCGParam("modulus", lcgM)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if m == nil {
+		// t[i+2] * t[i] - t[i+1]^2 is a multiple of m where t[i] = x[i+1] - x[i]
+		if len(x) < 6 {
+			return nil, nil, errors.New("recover LCG modulus: 6 outputs are required")
+		}
+		t := make([]*big.Int, len(x)-1)
+		for i := range t {
+			t[i] = new(big.Int).Sub(x[i+1], x[i])
+		}
+		m = new(big.Int)
+		for i := 0; i+2 < len(t); i++ {
+			u := new(big.Int).Mul(t[i+2], t[i])
+			u.Sub(u, new(big.Int).Mul(t[i+1], t[i+1]))
+			m.GCD(nil, nil, m, u.Abs(u))
+		}
+	}
+	if m.Sign() <= 0 {
+		return nil, nil, errors.New("recover LCG modulus")
+	}
+
+	if a == nil {
+		// a = (x[i+2] - x[i+1]) / (x[i+1] - x[i]) mod m
+		for i := 0; i+2 < len(x) && a == nil; i++ {
+			inverse := new(big.Int).ModInverse(new(big.Int).Sub(x[i+1], x[i]), m)
+			if inverse != nil {
+				a = new(big.Int).Sub(x[i+2], x[i+1])
+				a.Mul(a, inverse).Mod(a, m)
+			}
+		}
+		if a == nil {
+			return nil, nil, errors.New("recover LCG multiplier: more outputs are required")
+		}
+	}
+	if c == nil {
+		if len(x) < 2 {
+			return nil, nil, errors.New("recover LCG increment: 2 outputs are required")
+		}
+		c = new(big.Int).Mul(a, x[0])
+		c.Sub(x[1], c).Mod(c, m)
+	}
+
+	step := func(v *big.Int) *big.Int {
+		v = new(big.Int).Mul(a, v)
+		return v.Add(v, c).Mod(v, m)
+	}
+	for i := 0; i+1 < len(x); i++ {
+		if step(x[i]).Cmp(x[i+1]) != 0 {
+			return nil, nil, errors.New("match observed output " + strconv.Itoa(i+1) + ": the outputs are not from this LCG")
+		}
+	}
+
+	params := []string{"Modulus: " + m.String(), "Multiplier: " + a.String(), "Increment: " + c.String()}
+	next := make([]string, predictCount)
+	v := x[len(x)-1]
+	for i := range next {
+		v = step(v)
+		next[i] = v.String()
+	}
+	return params, next, nil
+}
+
+func init() {
+	encCmd.AddCommand(NewPrngCmd())
+}
@@ -17,52 +17,300 @@ package enc
 
 import (
 	"crypto/rand"
+	_ "embed"
+	"encoding/base32"
+	"encoding/base64"
 	"encoding/hex"
 	"fmt"
-	"strconv"
+	"math"
+	"math/big"
+	"strings"
 
 	"github.com/SignorMercurio/attrezzi/format"
+	"github.com/mr-tron/base58"
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
 
 var (
-	byteLength uint
-	numFmt     string
+	byteLength  uint
+	numFmt      string
+	rndCount    uint
+	rndMin      string
+	rndMax      string
+	password    bool
+	charClasses string
+	symbols     string
+	diceware    bool
+	wordCount   uint
+	wordSep     string
+	showEntropy bool
 )
 
+// effLargeWordlist is the EFF large wordlist for diceware passphrases:
+// https://www.eff.org/files/2016/07/18/eff_large_wordlist.txt
+//
+//go:embed eff_large_wordlist.txt
+var effLargeWordlist string
+
+// charClassSets maps character class names to their characters
+var charClassSets = map[string]string{
+	"lower": "abcdefghijklmnopqrstuvwxyz",
+	"upper": "ABCDEFGHIJKLMNOPQRSTUVWXYZ",
+	"digit": "0123456789",
+}
+
 // NewRndCmd represents the rnd command
 func NewRndCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "rnd",
-		Short: "Random number generation",
-		Long: `Random number generation
+		Short: "Random number / password / passphrase generation",
+		Long: `Random number / password / passphrase generation
+Random numbers in a range are output in decimal. Passwords contain at least one character of each class.
 Example:
 	att enc rnd -l 16 -f hex
-	att enc -o out.txt rnd -l 8 -f bin`,
-		Run: func(cmd *cobra.Command, args []string) {
-			b := make([]byte, byteLength)
-			rand.Read(b)
+	att enc -o out.txt rnd -l 8 -f bin
+	att enc rnd --min 1 --max 6 -n 10
+	att enc rnd --password -l 20 -c lower,upper,digit --entropy
+	att enc rnd --passphrase -w 6 --separator " "`,
+		Annotations: map[string]string{noInput: ""},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var generate func() (string, error)
+			var entropy float64
+
+			switch {
+			case password:
+				classes, err := getCharClasses()
+				if err != nil {
+					return err
+				}
+				if int(byteLength) < len(classes) {
+					return errors.New("validate password length: at least one character of each class is required")
+				}
+				generate = func() (string, error) { return genPassword(classes, int(byteLength)) }
+				entropy = passwordEntropy(classes, int(byteLength))
+			case diceware:
+				words := strings.Split(strings.TrimSpace(effLargeWordlist), "\n")
+				generate = func() (string, error) { return genPassphrase(words, int(wordCount)) }
+				entropy = float64(wordCount) * math.Log2(float64(len(words)))
+			case rndMin != "" || rndMax != "":
+				low, high, err := parseRange()
+				if err != nil {
+					return err
+				}
+				size := new(big.Int).Sub(high, low)
+				size.Add(size, big.NewInt(1))
+				generate = func() (string, error) {
+					n, err := rand.Int(rand.Reader, size)
+					if err != nil {
+						return "", errors.Wrap(err, "generate random number")
+					}
+					return n.Add(n, low).String(), nil
+				}
+				entropy = bigLog2(size)
+			default:
+				generate = func() (string, error) {
+					b := make([]byte, byteLength)
+					if _, err := rand.Read(b); err != nil {
+						return "", errors.Wrap(err, "generate random bytes")
+					}
+					return formatRnd(b)
+				}
+				entropy = float64(byteLength) * 8
+			}
+
+			results := make([]string, rndCount)
+			for i := range results {
+				var err error
+				if results[i], err = generate(); err != nil {
+					return err
+				}
+			}
+			if showEntropy {
+				results = append(results, fmt.Sprintf("Entropy: %.2f bits", entropy))
+			}
+			Echo(strings.Join(results, "\n"))
 
-			rnd := formatRnd(b)
-			Echo(rnd)
+			return nil
 		},
 	}
-	cmd.Flags().UintVarP(&byteLength, "length", "l", 8, "Byte length of generated number")
-	cmd.Flags().StringVarP(&numFmt, "format", "f", "hex", "Format of generated number: hex / bin / dec")
+	cmd.Flags().UintVarP(&byteLength, "length", "l", 8, "Byte length of generated number, or character length of generated password")
+	cmd.Flags().StringVarP(&numFmt, "format", "f", "hex", "Format of generated number: hex / bin / dec / b64 / b32 / b58")
+	cmd.Flags().UintVarP(&rndCount, "count", "n", 1, "Number of results to generate")
+	cmd.Flags().StringVar(&rndMin, "min", "", "Minimum of the generated integer, in decimal or 0x-prefixed hex")
+	cmd.Flags().StringVar(&rndMax, "max", "", "Maximum of the generated integer, in decimal or 0x-prefixed hex")
+	cmd.Flags().BoolVarP(&password, "password", "p", false, "Generate passwords")
+	cmd.Flags().StringVarP(&charClasses, "classes", "c", "lower,upper,digit,symbol", "Character classes of passwords: lower / upper / digit / symbol, comma-separated")
+	cmd.Flags().StringVar(&symbols, "symbols", "!@#$%^&*()-_=+[]{};:,.<>/?~", "Characters of the symbol class")
+	cmd.Flags().BoolVar(&diceware, "passphrase", false, "Generate diceware passphrases with the EFF large wordlist")
+	cmd.Flags().UintVarP(&wordCount, "words", "w", 6, "Number of words in passphrases")
+	cmd.Flags().StringVar(&wordSep, "separator", "-", "Separator of words in passphrases")
+	cmd.Flags().BoolVarP(&showEntropy, "entropy", "e", false, "Report the entropy of each result in bits")
 
 	return cmd
 }
 
-func formatRnd(b []byte) string {
-	rnd := hex.EncodeToString(b)
+func formatRnd(b []byte) (string, error) {
 	switch numFmt {
+	case "hex":
+		return hex.EncodeToString(b), nil
 	case "bin":
-		rnd = format.EncodeToBin(b)
+		return format.EncodeToBin(b), nil
 	case "dec":
-		num, _ := strconv.ParseUint(rnd, 16, 64)
-		rnd = fmt.Sprintf("%d", num)
+		return new(big.Int).SetBytes(b).String(), nil
+	case "b64":
+		return base64.StdEncoding.EncodeToString(b), nil
+	case "b32":
+		return base32.StdEncoding.EncodeToString(b), nil
+	case "b58":
+		return base58.Encode(b), nil
+	}
+	return "", errors.New("recognize format " + numFmt)
+}
+
+// parseRange parses the inclusive range of generated integers
+func parseRange() (*big.Int, *big.Int, error) {
+	low, high := big.NewInt(0), new(big.Int)
+	if rndMin != "" {
+		if _, ok := low.SetString(rndMin, 0); !ok {
+			return nil, nil, errors.New("parse minimum " + rndMin)
+		}
+	}
+	if rndMax == "" {
+		return nil, nil, errors.New("parse range: --max is required")
+	}
+	if _, ok := high.SetString(rndMax, 0); !ok {
+		return nil, nil, errors.New("parse maximum " + rndMax)
+	}
+	if high.Cmp(low) < 0 {
+		return nil, nil, errors.New("validate range: minimum is larger than maximum")
+	}
+	return low, high, nil
+}
+
+// getCharClasses gets the deduplicated characters of each class from user input
+func getCharClasses() ([]string, error) {
+	var classes []string
+	seen := map[rune]bool{}
+	for _, name := range strings.Split(charClasses, ",") {
+		name = strings.TrimSpace(name)
+		set, ok := charClassSets[name]
+		if name == "symbol" {
+			set, ok = symbols, true
+		}
+		if !ok {
+			return nil, errors.New("recognize character class " + name)
+		}
+
+		var chars []rune
+		for _, c := range set {
+			if !seen[c] {
+				seen[c] = true
+				chars = append(chars, c)
+			}
+		}
+		if len(chars) == 0 {
+			return nil, errors.New("validate character class " + name + ": it is empty or overlaps other classes")
+		}
+		classes = append(classes, string(chars))
+	}
+	return classes, nil
+}
+
+// randIndex returns a uniform random integer in [0, n)
+func randIndex(n int) (int, error) {
+	i, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0, errors.Wrap(err, "generate random number")
+	}
+	return int(i.Int64()), nil
+}
+
+// genPassword generates a password of [length] with at least one character from each of [classes].
+// It draws from all classes uniformly and rejects passwords missing a class, so that every valid
+// password is equally likely and passwordEntropy holds
+func genPassword(classes []string, length int) (string, error) {
+	all := []rune(strings.Join(classes, ""))
+	class := make(map[rune]int, len(all))
+	for i, chars := range classes {
+		for _, c := range chars {
+			class[c] = i
+		}
+	}
+
+	result := make([]rune, length)
+	for {
+		covered := make([]bool, len(classes))
+		for k := range result {
+			i, err := randIndex(len(all))
+			if err != nil {
+				return "", err
+			}
+			result[k] = all[i]
+			covered[class[all[i]]] = true
+		}
+
+		complete := true
+		for _, ok := range covered {
+			complete = complete && ok
+		}
+		if complete {
+			return string(result), nil
+		}
+	}
+}
+
+// genPassphrase generates a passphrase of [count] words
+func genPassphrase(lines []string, count int) (string, error) {
+	words := make([]string, count)
+	for k := range words {
+		i, err := randIndex(len(lines))
+		if err != nil {
+			return "", err
+		}
+		// each line is "<dice rolls>\t<word>"
+		fields := strings.Fields(lines[i])
+		words[k] = fields[len(fields)-1]
+	}
+	return strings.Join(words, wordSep), nil
+}
+
+// passwordEntropy computes log2 of the number of passwords of [length] covering all [classes]
+// by inclusion-exclusion over the classes left out
+func passwordEntropy(classes []string, length int) float64 {
+	total := new(big.Int)
+	for mask := 0; mask < 1<<len(classes); mask++ {
+		size, excluded := 0, 0
+		for i, class := range classes {
+			if mask&(1<<i) != 0 {
+				excluded++
+			} else {
+				size += len([]rune(class))
+			}
+		}
+
+		term := new(big.Int).Exp(big.NewInt(int64(size)), big.NewInt(int64(length)), nil)
+		if excluded%2 == 1 {
+			total.Sub(total, term)
+		} else {
+			total.Add(total, term)
+		}
+	}
+	return bigLog2(total)
+}
+
+// bigLog2 computes log2 of a positive [n]
+func bigLog2(n *big.Int) float64 {
+	if n.Sign() <= 0 {
+		return 0
+	}
+	// keep 53 significant bits for the float conversion
+	shift := n.BitLen() - 53
+	if shift < 0 {
+		shift = 0
 	}
-	return rnd
+	mantissa, _ := new(big.Float).SetInt(new(big.Int).Rsh(n, uint(shift))).Float64()
+	return math.Log2(mantissa) + float64(shift)
 }
 
 func init() {
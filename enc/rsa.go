@@ -21,7 +21,6 @@ import (
 	"crypto/x509"
 	"encoding/pem"
 	"io/ioutil"
-	"os"
 
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
@@ -91,50 +90,95 @@ Example:
 	return cmd
 }
 
-// importPrivKey loads the private key from a file
+// importPrivKey loads the RSA private key from a file
 func importPrivKey(filename string) (*rsa.PrivateKey, error) {
-	privKeyOut, err := os.Open(filename)
+	keyBytes, err := ioutil.ReadFile(filename)
 	if err != nil {
 		return nil, errors.Wrap(err, "open privkey input file")
 	}
-	defer privKeyOut.Close()
 
-	keyBytes, _ := ioutil.ReadAll(privKeyOut)
-
-	block, _ := pem.Decode(keyBytes)
-	if block == nil {
-		return nil, errors.New("decode pubkey PEM")
-	}
-
-	privKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	privKey, err := parsePrivKey(keyBytes)
 	if err != nil {
-		return nil, errors.Wrap(err, "parse privkey")
+		return nil, err
 	}
 
-	return privKey.(*rsa.PrivateKey), nil
+	rsaPrivKey, ok := privKey.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("parse privkey as RSA key")
+	}
+	return rsaPrivKey, nil
 }
 
-// importPubKey loads the public  key from a file
+// importPubKey loads the RSA public key from a file
 func importPubKey(filename string) (*rsa.PublicKey, error) {
-	pubKeyOut, err := os.Open(filename)
+	keyBytes, err := ioutil.ReadFile(filename)
 	if err != nil {
 		return nil, errors.Wrap(err, "open pubkey input file")
 	}
-	defer pubKeyOut.Close()
 
-	keyBytes, _ := ioutil.ReadAll(pubKeyOut)
+	pubKey, err := parsePubKey(keyBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	rsaPubKey, ok := pubKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("parse pubkey as RSA key")
+	}
+	return rsaPubKey, nil
+}
+
+// parsePrivKey parses a PEM encoded private key
+func parsePrivKey(keyBytes []byte) (interface{}, error) {
+	block, _ := pem.Decode(keyBytes)
+	if block == nil {
+		return nil, errors.New("decode privkey PEM")
+	}
+
+	return parsePrivKeyDER(block.Bytes)
+}
+
+// parsePrivKeyDER parses a DER encoded private key in PKCS #8, PKCS #1 or SEC 1 form
+func parsePrivKeyDER(der []byte) (interface{}, error) {
+	if privKey, err := parseX25519PrivKeyDER(der); err == nil {
+		return privKey, nil
+	}
+	if privKey, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		return privKey, nil
+	}
+	if privKey, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return privKey, nil
+	}
+	if privKey, err := x509.ParseECPrivateKey(der); err == nil {
+		return privKey, nil
+	}
 
+	return nil, errors.New("parse privkey")
+}
+
+// parsePubKey parses a PEM encoded public key
+func parsePubKey(keyBytes []byte) (interface{}, error) {
 	block, _ := pem.Decode(keyBytes)
 	if block == nil {
 		return nil, errors.New("decode pubkey PEM")
 	}
 
-	pubKey, err := x509.ParsePKIXPublicKey(block.Bytes)
-	if err != nil {
-		return nil, errors.Wrap(err, "parse pubkey")
+	return parsePubKeyDER(block.Bytes)
+}
+
+// parsePubKeyDER parses a DER encoded public key in PKIX or PKCS #1 form
+func parsePubKeyDER(der []byte) (interface{}, error) {
+	if pubKey, err := parseX25519PubKeyDER(der); err == nil {
+		return pubKey, nil
+	}
+	if pubKey, err := x509.ParsePKIXPublicKey(der); err == nil {
+		return pubKey, nil
+	}
+	if pubKey, err := x509.ParsePKCS1PublicKey(der); err == nil {
+		return pubKey, nil
 	}
 
-	return pubKey.(*rsa.PublicKey), nil
+	return nil, errors.New("parse pubkey")
 }
 
 func init() {
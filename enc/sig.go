@@ -0,0 +1,390 @@
+/*
+Copyright © 2021 SignorMercurio
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package enc
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	sshSigMagic   = "SSHSIG"
+	sshSigVersion = 1
+	sshSigPEMType = "SSH SIGNATURE"
+)
+
+var (
+	sigPath   string
+	sigFmt    string
+	namespace string
+)
+
+// ecdsaSignature is the ASN.1 structure of an ECDSA signature
+type ecdsaSignature struct {
+	R, S *big.Int
+}
+
+// sshSigBlob is the OpenSSH signature blob in PROTOCOL.sshsig
+type sshSigBlob struct {
+	Version   uint32
+	PublicKey []byte
+	Namespace string
+	Reserved  string
+	HashAlg   string
+	Signature []byte
+}
+
+// sshSignedData is the data actually signed in PROTOCOL.sshsig, after the magic preamble
+type sshSignedData struct {
+	Namespace string
+	Reserved  string
+	HashAlg   string
+	Hash      []byte
+}
+
+// NewSigCmd represents the sig command
+func NewSigCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "sig",
+		Short: "Digital signature generation / verification",
+		Long: `Digital signature generation / verification with RSA, ECDSA and Ed25519 keys
+Example:
+	att enc -i release.tar.gz -o release.tar.gz.sig sig -s --priv priv.pem -f b64
+	att enc -i release.tar.gz sig -v --pub pub.pem --sig release.tar.gz.sig -f b64
+	att enc -i file.txt -o file.txt.sig sig -s --priv id_ed25519 -f ssh -n file
+	att enc -i file.txt sig -v --pub id_ed25519.pub --sig file.txt.sig -f ssh -n file`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if enc {
+				signature, err := signInput()
+				if err != nil {
+					return err
+				}
+				Echo(string(signature))
+			} else if dec {
+				if err := verifyInput(); err != nil {
+					return err
+				}
+				Echo("Signature verified")
+			} else {
+				NoActionSpecified()
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVarP(&enc, "sign", "s", false, "Sign the input")
+	cmd.Flags().BoolVarP(&dec, "verify", "v", false, "Verify the signature of the input")
+	cmd.Flags().StringVar(&privKeyPath, "priv", "./priv.pem", "Path of the private key to sign with")
+	cmd.Flags().StringVar(&pubKeyPath, "pub", "./pub.pem", "Path of the public key to verify with")
+	cmd.Flags().StringVar(&sigPath, "sig", "", "Path of the detached signature to verify")
+	cmd.Flags().StringVarP(&sigFmt, "format", "f", "der", "Signature format: raw / der / b64 (base64 of der) / ssh")
+	cmd.Flags().StringVarP(&rsaMode, "mode", "m", "pss", "RSA signature scheme: pss / pkcs1v15")
+	cmd.Flags().StringVar(&hashFunc, "hash", "sha256", "Hash function for RSA / ECDSA: sha1 / sha256 / sha384 / sha512")
+	cmd.Flags().StringVarP(&namespace, "namespace", "n", "file", "Namespace of OpenSSH signatures")
+
+	return cmd
+}
+
+// signInput signs the input with the private key in the format from user input
+func signInput() ([]byte, error) {
+	k, err := loadKeyFile(privKeyPath, "")
+	if err != nil {
+		return nil, err
+	}
+	if !isPrivKey(k) {
+		return nil, errors.New("sign with a public key")
+	}
+
+	if sigFmt == "ssh" {
+		return sshSign(k, inputBytes)
+	}
+	signature, err := signDigest(k, inputBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	switch sigFmt {
+	case "raw":
+		if ecPrivKey, ok := k.(*ecdsa.PrivateKey); ok {
+			return ecdsaDERToRaw(signature, ecPrivKey.Curve.Params().BitSize)
+		}
+		return signature, nil
+	case "b64":
+		return []byte(base64.StdEncoding.EncodeToString(signature)), nil
+	default:
+		return signature, nil
+	}
+}
+
+// verifyInput verifies the detached signature of the input with the public key
+func verifyInput() error {
+	k, err := loadKeyFile(pubKeyPath, "")
+	if err != nil {
+		return err
+	}
+	pub := publicKey(k)
+	signature, err := os.ReadFile(sigPath)
+	if err != nil {
+		return errors.Wrap(err, "read signature file")
+	}
+
+	switch sigFmt {
+	case "ssh":
+		return sshVerify(pub, inputBytes, signature)
+	case "b64":
+		if signature, err = base64.StdEncoding.DecodeString(string(bytes.TrimSpace(signature))); err != nil {
+			return errors.Wrap(err, "decode signature")
+		}
+	case "raw":
+		if _, ok := pub.(*ecdsa.PublicKey); ok {
+			if signature, err = ecdsaRawToDER(signature); err != nil {
+				return err
+			}
+		}
+	}
+
+	return verifyDigest(pub, inputBytes, signature)
+}
+
+// signDigest signs [msg] with [k], returning DER signatures for ECDSA
+func signDigest(k interface{}, msg []byte) ([]byte, error) {
+	if edPrivKey, ok := k.(ed25519.PrivateKey); ok {
+		return ed25519.Sign(edPrivKey, msg), nil
+	}
+
+	hashID, err := getHashID()
+	if err != nil {
+		return nil, err
+	}
+	h := hashID.New()
+	h.Write(msg)
+	digest := h.Sum(nil)
+
+	var signature []byte
+	switch k := k.(type) {
+	case *rsa.PrivateKey:
+		if rsaMode == "pkcs1v15" {
+			signature, err = rsa.SignPKCS1v15(rand.Reader, k, hashID, digest)
+		} else {
+			signature, err = rsa.SignPSS(rand.Reader, k, hashID, digest, nil)
+		}
+	case *ecdsa.PrivateKey:
+		signature, err = ecdsa.SignASN1(rand.Reader, k, digest)
+	default:
+		return nil, errors.New("sign with unsupported key type")
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "sign input")
+	}
+	return signature, nil
+}
+
+// verifyDigest verifies the signature of [msg] with [pub], expecting DER signatures for ECDSA
+func verifyDigest(pub interface{}, msg, signature []byte) error {
+	if edPubKey, ok := pub.(ed25519.PublicKey); ok {
+		if !ed25519.Verify(edPubKey, msg, signature) {
+			return errors.New("verify signature")
+		}
+		return nil
+	}
+
+	hashID, err := getHashID()
+	if err != nil {
+		return err
+	}
+	h := hashID.New()
+	h.Write(msg)
+	digest := h.Sum(nil)
+
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		if rsaMode == "pkcs1v15" {
+			err = rsa.VerifyPKCS1v15(pub, hashID, digest, signature)
+		} else {
+			err = rsa.VerifyPSS(pub, hashID, digest, signature, nil)
+		}
+		return errors.Wrap(err, "verify signature")
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(pub, digest, signature) {
+			return errors.New("verify signature")
+		}
+		return nil
+	default:
+		return errors.New("verify with unsupported key type")
+	}
+}
+
+// ecdsaDERToRaw converts a DER ECDSA signature to the fixed-size r || s form
+func ecdsaDERToRaw(der []byte, bitSize int) ([]byte, error) {
+	var sig ecdsaSignature
+	if _, err := asn1.Unmarshal(der, &sig); err != nil {
+		return nil, errors.Wrap(err, "parse ECDSA signature")
+	}
+	size := (bitSize + 7) / 8
+	return append(sig.R.FillBytes(make([]byte, size)), sig.S.FillBytes(make([]byte, size))...), nil
+}
+
+// ecdsaRawToDER converts a fixed-size r || s ECDSA signature to DER
+func ecdsaRawToDER(raw []byte) ([]byte, error) {
+	if len(raw) == 0 || len(raw)%2 != 0 {
+		return nil, errors.New("parse raw ECDSA signature")
+	}
+	half := len(raw) / 2
+	return asn1.Marshal(ecdsaSignature{
+		R: new(big.Int).SetBytes(raw[:half]),
+		S: new(big.Int).SetBytes(raw[half:]),
+	})
+}
+
+// sshSign creates an armored OpenSSH signature of [msg], compatible with ssh-keygen -Y sign
+func sshSign(k interface{}, msg []byte) ([]byte, error) {
+	signer, err := ssh.NewSignerFromKey(k)
+	if err != nil {
+		return nil, errors.Wrap(err, "create OpenSSH signer")
+	}
+
+	digest := sha512.Sum512(msg)
+	signedData := append([]byte(sshSigMagic), ssh.Marshal(sshSignedData{
+		Namespace: namespace,
+		HashAlg:   "sha512",
+		Hash:      digest[:],
+	})...)
+
+	var signature *ssh.Signature
+	if algSigner, ok := signer.(ssh.AlgorithmSigner); ok && signer.PublicKey().Type() == ssh.KeyAlgoRSA {
+		signature, err = algSigner.SignWithAlgorithm(rand.Reader, signedData, ssh.SigAlgoRSASHA2512)
+	} else {
+		signature, err = signer.Sign(rand.Reader, signedData)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "sign input")
+	}
+
+	blob := append([]byte(sshSigMagic), ssh.Marshal(sshSigBlob{
+		Version:   sshSigVersion,
+		PublicKey: signer.PublicKey().Marshal(),
+		Namespace: namespace,
+		HashAlg:   "sha512",
+		Signature: ssh.Marshal(signature),
+	})...)
+
+	return armorSSHSig(blob), nil
+}
+
+// sshVerify verifies an armored OpenSSH signature of [msg] made by [pub]
+func sshVerify(pub interface{}, msg, armored []byte) error {
+	block, _ := pem.Decode(armored)
+	if block == nil || block.Type != sshSigPEMType || !bytes.HasPrefix(block.Bytes, []byte(sshSigMagic)) {
+		return errors.New("decode OpenSSH signature")
+	}
+
+	var blob sshSigBlob
+	if err := ssh.Unmarshal(block.Bytes[len(sshSigMagic):], &blob); err != nil {
+		return errors.Wrap(err, "parse OpenSSH signature")
+	}
+	if blob.Version != sshSigVersion {
+		return errors.Errorf("recognize OpenSSH signature version %d", blob.Version)
+	}
+	if blob.Namespace != namespace {
+		return errors.Errorf("verify OpenSSH signature: namespace is %s, not %s", blob.Namespace, namespace)
+	}
+
+	sigPubKey, err := ssh.ParsePublicKey(blob.PublicKey)
+	if err != nil {
+		return errors.Wrap(err, "parse signer pubkey")
+	}
+	sshPubKey, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		return errors.Wrap(err, "convert to OpenSSH public key")
+	}
+	if !bytes.Equal(sigPubKey.Marshal(), sshPubKey.Marshal()) {
+		return errors.New("verify OpenSSH signature: signed by " + ssh.FingerprintSHA256(sigPubKey))
+	}
+
+	var digest []byte
+	switch blob.HashAlg {
+	case "sha256":
+		sum := sha256.Sum256(msg)
+		digest = sum[:]
+	case "sha512":
+		sum := sha512.Sum512(msg)
+		digest = sum[:]
+	default:
+		return errors.New("recognize OpenSSH signature hash " + blob.HashAlg)
+	}
+
+	signature := &ssh.Signature{}
+	if err := ssh.Unmarshal(blob.Signature, signature); err != nil {
+		return errors.Wrap(err, "parse OpenSSH signature")
+	}
+	signedData := append([]byte(sshSigMagic), ssh.Marshal(sshSignedData{
+		Namespace: blob.Namespace,
+		Reserved:  blob.Reserved,
+		HashAlg:   blob.HashAlg,
+		Hash:      digest,
+	})...)
+
+	return errors.Wrap(sshPubKey.Verify(signedData, signature), "verify signature")
+}
+
+// armorSSHSig armors an OpenSSH signature blob the way ssh-keygen does, with 70 columns per line
+func armorSSHSig(blob []byte) []byte {
+	encoded := base64.StdEncoding.EncodeToString(blob)
+
+	var b bytes.Buffer
+	b.WriteString("-----BEGIN " + sshSigPEMType + "-----\n")
+	for len(encoded) > 70 {
+		b.WriteString(encoded[:70] + "\n")
+		encoded = encoded[70:]
+	}
+	b.WriteString(encoded + "\n")
+	b.WriteString("-----END " + sshSigPEMType + "-----\n")
+	return b.Bytes()
+}
+
+// getHashID gets the crypto.Hash of the hash function from user input
+func getHashID() (crypto.Hash, error) {
+	switch hashFunc {
+	case "sha1":
+		return crypto.SHA1, nil
+	case "sha256":
+		return crypto.SHA256, nil
+	case "sha384":
+		return crypto.SHA384, nil
+	case "sha512":
+		return crypto.SHA512, nil
+	default:
+		return 0, errors.New("recognize hash function " + hashFunc)
+	}
+}
+
+func init() {
+	encCmd.AddCommand(NewSigCmd())
+}
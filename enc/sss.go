@@ -0,0 +1,288 @@
+/*
+Copyright © 2021 SignorMercurio
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package enc
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var (
+	split     bool
+	combine   bool
+	shares    int
+	threshold int
+	shareFmt  string
+)
+
+const (
+	// shareChecksumSize is the size of the checksum appended to each share and to the secret
+	shareChecksumSize = 4
+	// mnemonicConsonants, mnemonicVowels and mnemonicEndings build the 256 words of the mnemonic form
+	mnemonicConsonants = "bdfghjklmnprstvz"
+	mnemonicVowels     = "aiou"
+	mnemonicEndings    = "kmst"
+)
+
+// gfExp and gfLog are the exponent and logarithm tables of GF(2^8) with generator 3
+var gfExp, gfLog [256]byte
+
+// NewSssCmd represents the sss command
+func NewSssCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "sss",
+		Short: "Shamir secret sharing split / combine",
+		Long: `Shamir secret sharing split / combine over GF(256)
+Each share carries the threshold, its index and a checksum, and the secret is checksummed before splitting
+Example:
+	att enc -i priv.pem sss -s -n 5 -k 3 > shares.txt
+	head -n 3 shares.txt | att enc sss -c
+	att enc -i secret.txt sss -s -n 3 -k 2 -f mnemonic
+	att enc -i shares.txt sss -c -f mnemonic`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if split {
+				parts, err := splitSecret(inputBytes, shares, threshold)
+				if err != nil {
+					return err
+				}
+
+				encoded := make([]string, len(parts))
+				for i, share := range parts {
+					if encoded[i], err = encodeShare(share); err != nil {
+						return err
+					}
+				}
+				Echo(strings.Join(encoded, "\n"))
+			} else if combine {
+				var decoded [][]byte
+				for i, line := range strings.Split(string(inputBytes), "\n") {
+					if strings.TrimSpace(line) == "" {
+						continue
+					}
+					share, err := decodeShare(line)
+					if err != nil {
+						return errors.Wrap(err, "decode share on line "+strconv.Itoa(i+1))
+					}
+					decoded = append(decoded, share)
+				}
+
+				secret, err := combineShares(decoded)
+				if err != nil {
+					return err
+				}
+				Echo(string(secret))
+			} else {
+				NoActionSpecified()
+			}
+
+			return nil
+		},
+	}
+	cmd.Flags().BoolVarP(&split, "split", "s", false, "Split the secret into shares")
+	cmd.Flags().BoolVarP(&combine, "combine", "c", false, "Combine shares, one per line, into the secret")
+	cmd.Flags().IntVarP(&shares, "shares", "n", 5, "Number of shares to split into, at most 255")
+	cmd.Flags().IntVarP(&threshold, "threshold", "k", 3, "Number of shares required to combine")
+	cmd.Flags().StringVarP(&shareFmt, "format", "f", "hex", "Format of shares: hex / b64 / mnemonic")
+
+	return cmd
+}
+
+// splitSecret splits [secret] into [n] shares of which any [k] recover it.
+// A share is threshold || index || y-values || checksum
+func splitSecret(secret []byte, n, k int) ([][]byte, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("split empty secret")
+	}
+	if k < 2 || k > n || n > 255 {
+		return nil, errors.New("validate shares and threshold: 2 <= k <= n <= 255 is required")
+	}
+
+	sum := sha256.Sum256(secret)
+	secret = append(secret[:len(secret):len(secret)], sum[:shareChecksumSize]...)
+
+	result := make([][]byte, n)
+	for i := range result {
+		result[i] = []byte{byte(k), byte(i + 1)}
+	}
+
+	coeffs := make([]byte, k)
+	for _, b := range secret {
+		// random polynomial of degree k-1 with the secret byte as the constant term
+		coeffs[0] = b
+		copy(coeffs[1:], genNonce(k-1))
+		for i := range result {
+			result[i] = append(result[i], evalPolynomial(coeffs, byte(i+1)))
+		}
+	}
+
+	for i, share := range result {
+		sum := sha256.Sum256(share)
+		result[i] = append(share, sum[:shareChecksumSize]...)
+	}
+	return result, nil
+}
+
+// combineShares recovers the secret from shares by Lagrange interpolation at 0
+func combineShares(shares [][]byte) ([]byte, error) {
+	if len(shares) == 0 {
+		return nil, errors.New("find any share")
+	}
+
+	k := int(shares[0][0])
+	size := len(shares[0])
+	seen := map[byte]bool{}
+	for _, share := range shares {
+		if int(share[0]) != k || len(share) != size {
+			return nil, errors.New("combine shares from different splits")
+		}
+		if seen[share[1]] {
+			return nil, errors.New("combine duplicate share " + strconv.Itoa(int(share[1])))
+		}
+		seen[share[1]] = true
+	}
+	if len(shares) < k {
+		return nil, errors.New("combine shares: " + strconv.Itoa(k) + " shares are required, got " + strconv.Itoa(len(shares)))
+	}
+	shares = shares[:k]
+
+	secret := make([]byte, size-2)
+	for i, share := range shares {
+		// Lagrange basis polynomial of share i evaluated at 0
+		basis := byte(1)
+		for j, other := range shares {
+			if i != j {
+				basis = gfMul(basis, gfDiv(other[1], other[1]^share[1]))
+			}
+		}
+		for pos := range secret {
+			secret[pos] ^= gfMul(basis, share[pos+2])
+		}
+	}
+
+	secret, sum := secret[:len(secret)-shareChecksumSize], secret[len(secret)-shareChecksumSize:]
+	expected := sha256.Sum256(secret)
+	if !bytes.Equal(sum, expected[:shareChecksumSize]) {
+		return nil, errors.New("verify checksum of the combined secret")
+	}
+	return secret, nil
+}
+
+// evalPolynomial evaluates the polynomial with [coeffs] at [x] using Horner's method
+func evalPolynomial(coeffs []byte, x byte) byte {
+	y := byte(0)
+	for i := len(coeffs) - 1; i >= 0; i-- {
+		y = gfMul(y, x) ^ coeffs[i]
+	}
+	return y
+}
+
+// gfMul multiplies in GF(2^8)
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[(int(gfLog[a])+int(gfLog[b]))%255]
+}
+
+// gfDiv divides in GF(2^8), [b] must not be 0
+func gfDiv(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return gfExp[(int(gfLog[a])-int(gfLog[b])+255)%255]
+}
+
+// encodeShare encodes a share in the specified format
+func encodeShare(share []byte) (string, error) {
+	switch shareFmt {
+	case "hex":
+		return hex.EncodeToString(share), nil
+	case "b64":
+		return base64.StdEncoding.EncodeToString(share), nil
+	case "mnemonic":
+		words := make([]string, len(share))
+		for i, b := range share {
+			words[i] = string([]byte{mnemonicConsonants[b>>4], mnemonicVowels[b>>2&3], mnemonicEndings[b&3]})
+		}
+		return strings.Join(words, " "), nil
+	}
+	return "", errors.New("recognize share format " + shareFmt)
+}
+
+// decodeShare decodes a share in the specified format and verifies its checksum
+func decodeShare(encoded string) ([]byte, error) {
+	encoded = strings.TrimSpace(encoded)
+
+	var share []byte
+	var err error
+	switch shareFmt {
+	case "hex":
+		share, err = hex.DecodeString(encoded)
+	case "b64":
+		share, err = base64.StdEncoding.DecodeString(encoded)
+	case "mnemonic":
+		for _, word := range strings.Fields(encoded) {
+			if len(word) != 3 {
+				return nil, errors.New("recognize mnemonic word " + word)
+			}
+			hi := strings.IndexByte(mnemonicConsonants, word[0])
+			mid := strings.IndexByte(mnemonicVowels, word[1])
+			lo := strings.IndexByte(mnemonicEndings, word[2])
+			if hi < 0 || mid < 0 || lo < 0 {
+				return nil, errors.New("recognize mnemonic word " + word)
+			}
+			share = append(share, byte(hi<<4|mid<<2|lo))
+		}
+	default:
+		return nil, errors.New("recognize share format " + shareFmt)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(share) < 3+2*shareChecksumSize {
+		return nil, errors.New("validate share length")
+	}
+	body, sum := share[:len(share)-shareChecksumSize], share[len(share)-shareChecksumSize:]
+	expected := sha256.Sum256(body)
+	if !bytes.Equal(sum, expected[:shareChecksumSize]) {
+		return nil, errors.New("verify checksum of the share")
+	}
+	if body[1] == 0 {
+		return nil, errors.New("validate share index")
+	}
+	return body, nil
+}
+
+func init() {
+	x := byte(1)
+	for i := 0; i < 255; i++ {
+		gfExp[i] = x
+		gfLog[x] = byte(i)
+		// multiply by the generator 3 modulo x^8 + x^4 + x^3 + x + 1
+		x ^= x<<1 ^ (x>>7)*0x1b
+	}
+	gfExp[255] = gfExp[0]
+
+	encCmd.AddCommand(NewSssCmd())
+}
@@ -0,0 +1,131 @@
+/*
+Copyright © 2021 SignorMercurio
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package enc
+
+import (
+	"crypto/subtle"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/curve25519"
+)
+
+// oidX25519 is the algorithm identifier of X25519 keys in RFC 8410
+var oidX25519 = asn1.ObjectIdentifier{1, 3, 101, 110}
+
+// x25519PrivateKey is a raw X25519 scalar
+type x25519PrivateKey []byte
+
+// x25519PublicKey is a raw X25519 point
+type x25519PublicKey []byte
+
+// pkcs8 is the PKCS #8 structure of a private key
+type pkcs8 struct {
+	Version    int
+	Algo       pkix.AlgorithmIdentifier
+	PrivateKey []byte
+}
+
+// pkixPublicKey is the SubjectPublicKeyInfo structure of a public key
+type pkixPublicKey struct {
+	Algo      pkix.AlgorithmIdentifier
+	PublicKey asn1.BitString
+}
+
+// genX25519Key generates an X25519 private key
+func genX25519Key() x25519PrivateKey {
+	return x25519PrivateKey(genNonce(curve25519.ScalarSize))
+}
+
+// Public returns the public key of [k]
+func (k x25519PrivateKey) Public() x25519PublicKey {
+	pub, _ := curve25519.X25519(k, curve25519.Basepoint)
+	return pub
+}
+
+// x25519 computes the shared secret of [priv] and [pub], rejecting low-order points
+func x25519(priv x25519PrivateKey, pub x25519PublicKey) ([]byte, error) {
+	shared, err := curve25519.X25519(priv, pub)
+	if err != nil {
+		return nil, errors.Wrap(err, "compute X25519 shared secret")
+	}
+	if subtle.ConstantTimeCompare(shared, make([]byte, len(shared))) == 1 {
+		return nil, errors.New("compute X25519 shared secret: low order point")
+	}
+	return shared, nil
+}
+
+// marshalX25519PrivKeyDER marshals an X25519 private key to PKCS #8
+func marshalX25519PrivKeyDER(k x25519PrivateKey) ([]byte, error) {
+	scalar, _ := asn1.Marshal([]byte(k))
+	return asn1.Marshal(pkcs8{
+		Algo:       pkix.AlgorithmIdentifier{Algorithm: oidX25519},
+		PrivateKey: scalar,
+	})
+}
+
+// marshalX25519PubKeyDER marshals an X25519 public key to PKIX
+func marshalX25519PubKeyDER(k x25519PublicKey) ([]byte, error) {
+	return asn1.Marshal(pkixPublicKey{
+		Algo:      pkix.AlgorithmIdentifier{Algorithm: oidX25519},
+		PublicKey: asn1.BitString{Bytes: k, BitLength: len(k) * 8},
+	})
+}
+
+// parseX25519PrivKeyDER parses a PKCS #8 X25519 private key
+func parseX25519PrivKeyDER(der []byte) (x25519PrivateKey, error) {
+	var p pkcs8
+	if rest, err := asn1.Unmarshal(der, &p); err != nil || len(rest) > 0 || !p.Algo.Algorithm.Equal(oidX25519) {
+		return nil, errors.New("parse X25519 privkey")
+	}
+
+	var scalar []byte
+	if _, err := asn1.Unmarshal(p.PrivateKey, &scalar); err != nil || len(scalar) != curve25519.ScalarSize {
+		return nil, errors.New("parse X25519 privkey")
+	}
+	return scalar, nil
+}
+
+// parseX25519PubKeyDER parses a PKIX X25519 public key
+func parseX25519PubKeyDER(der []byte) (x25519PublicKey, error) {
+	var p pkixPublicKey
+	if rest, err := asn1.Unmarshal(der, &p); err != nil || len(rest) > 0 || !p.Algo.Algorithm.Equal(oidX25519) {
+		return nil, errors.New("parse X25519 pubkey")
+	}
+
+	if len(p.PublicKey.Bytes) != curve25519.PointSize {
+		return nil, errors.New("parse X25519 pubkey")
+	}
+	return p.PublicKey.Bytes, nil
+}
+
+// parseX25519JWK converts an X25519 OKP JWK to a key
+func parseX25519JWK(j *jwk) (interface{}, error) {
+	if j.D != "" {
+		d, err := base64.RawURLEncoding.DecodeString(j.D)
+		if err != nil || len(d) != curve25519.ScalarSize {
+			return nil, errors.New("decode X25519 private key")
+		}
+		return x25519PrivateKey(d), nil
+	}
+	x, err := base64.RawURLEncoding.DecodeString(j.X)
+	if err != nil || len(x) != curve25519.PointSize {
+		return nil, errors.New("decode X25519 public key")
+	}
+	return x25519PublicKey(x), nil
+}
@@ -0,0 +1,72 @@
+/*
+Copyright © 2021 SignorMercurio
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package format
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// b100Offset is the code point that byte 0 is mapped to in Base100
+const b100Offset = 0x1f3f7
+
+// NewB100Cmd represents the b100 command
+func NewB100Cmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "b100",
+		Short: "Base100 (emoji) encode / decode",
+		Long: `Base100 (emoji) encode / decode
+Each byte is mapped to an emoji from U+1F3F7 to U+1F4F6.
+Example:
+	echo -n "hello" | att fmt -o out.txt b100 -e
+	att fmt -i in.txt b100 -d`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if encode {
+				var b strings.Builder
+				for _, c := range inputBytes {
+					b.WriteRune(rune(b100Offset + int(c)))
+				}
+				Echo(b.String())
+			} else if decode {
+				var decoded []byte
+				for _, r := range string(inputBytes) {
+					if unicode.IsSpace(r) {
+						continue
+					}
+					if r < b100Offset || r > b100Offset+0xff {
+						return errors.New("decode base100: invalid character " + string(r))
+					}
+					decoded = append(decoded, byte(r-b100Offset))
+				}
+				Echo(string(decoded))
+			} else {
+				NoActionSpecified()
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVarP(&encode, "encode", "e", false, "Encode to base100")
+	cmd.Flags().BoolVarP(&decode, "decode", "d", false, "Decode from base100")
+
+	return cmd
+}
+
+func init() {
+	fmtCmd.AddCommand(NewB100Cmd())
+}
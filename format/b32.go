@@ -17,25 +17,61 @@ package format
 
 import (
 	"encoding/base32"
+	"math/big"
+	"strings"
 
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
 
+var crockfordCheck bool
+
+// b32Preset is a named base32 alphabet
+type b32Preset struct {
+	alphabet string
+	padded   bool
+}
+
+// b32Presets maps preset names to base32 alphabets
+var b32Presets = map[string]b32Preset{
+	"std":       {"ABCDEFGHIJKLMNOPQRSTUVWXYZ234567", true},
+	"hex":       {"0123456789ABCDEFGHIJKLMNOPQRSTUV", true},
+	"crockford": {"0123456789ABCDEFGHJKMNPQRSTVWXYZ", false},
+	"z":         {"ybndrfg8ejkmcpqxot1uwisza345h769", false},
+	"geohash":   {"0123456789bcdefghjkmnpqrstuvwxyz", false},
+	"wordsafe":  {"23456789CFGHJMPQRVWXcfghjmpqrvwx", false},
+}
+
+// crockfordCheckSymbols extends the Crockford alphabet to the 37 check symbols
+const crockfordCheckSymbols = "*~$=U"
+
 // NewB32Cmd represents the b32 command
 func NewB32Cmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "b32",
 		Short: "Base32 encode / decode",
 		Long: `Base32 encode / decode
+Presets: std / hex (RFC 4648 base32hex) / crockford / z (z-base-32) / geohash / wordsafe.
+Only std and hex are padded by default. Decoding ignores whitespace, and is case-insensitive
+for single-case alphabets. Crockford decoding also ignores hyphens and reads I / L as 1 and O as 0.
 Example:
 	echo -n "hello" | att fmt -o out.txt b32 -e
-	att fmt -i in.txt b32 -d`,
+	att fmt -i in.txt b32 -d
+	echo -n "hello" | att fmt b32 -e -a crockford --check`,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if preset, ok := b32Presets[alphabet]; ok && !preset.padded && !cmd.Flags().Changed("padding") {
+				padding = ""
+			}
+			if crockfordCheck && alphabet != "crockford" {
+				return errors.New("validate check symbol: only crockford supports it")
+			}
 			enc := getB32Encoding()
 
 			if encode {
 				encoded := enc.EncodeToString(inputBytes)
+				if crockfordCheck {
+					encoded += string(crockfordCheckSymbol(inputBytes))
+				}
 				Echo(encoded)
 			} else if decode {
 				decoded, err := decodeBase32(enc)
@@ -51,23 +87,24 @@ Example:
 	}
 	cmd.Flags().BoolVarP(&encode, "encode", "e", false, "Encode to base32")
 	cmd.Flags().BoolVarP(&decode, "decode", "d", false, "Decode from base32")
-	cmd.Flags().StringVarP(&alphabet, "alphabet", "a", "std", `32-byte Alphabet for base32, or "hex" for hex encoding (See RFC 4648)`)
+	cmd.Flags().StringVarP(&alphabet, "alphabet", "a", "std", `32-byte Alphabet for base32, or a preset: std / hex / crockford / z / geohash / wordsafe`)
 	cmd.Flags().StringVarP(&padding, "padding", "p", "=", `Padding for base32, or "" for no padding`)
+	cmd.Flags().BoolVar(&crockfordCheck, "check", false, "Append / verify the Crockford check symbol of the input as a big-endian integer")
 
 	return cmd
 }
 
+// getB32Alphabet gets the base32 alphabet from user input
+func getB32Alphabet() string {
+	if preset, ok := b32Presets[alphabet]; ok {
+		return preset.alphabet
+	}
+	return alphabet
+}
+
 // getB32Encoding gets the base32 encoding from user input
 func getB32Encoding() *base32.Encoding {
-	var enc *base32.Encoding
-	switch alphabet {
-	case "std":
-		enc = base32.StdEncoding
-	case "hex":
-		enc = base32.HexEncoding
-	default:
-		enc = base32.NewEncoding(alphabet)
-	}
+	enc := base32.NewEncoding(getB32Alphabet())
 	if padding == "" {
 		return enc.WithPadding(base32.NoPadding)
 	}
@@ -75,15 +112,62 @@ func getB32Encoding() *base32.Encoding {
 	return enc.WithPadding([]rune(padding)[0])
 }
 
+// normalizeBase32 removes whitespace from [s] and folds it to the case of [chars]
+// if the alphabet is single-case
+func normalizeBase32(s, chars string) string {
+	s = strings.Join(strings.Fields(s), "")
+	if alphabet == "crockford" {
+		s = strings.NewReplacer("-", "", "I", "1", "L", "1", "O", "0").Replace(strings.ToUpper(s))
+	}
+
+	switch {
+	case strings.ToUpper(chars) == chars && strings.ToLower(chars) != chars:
+		return strings.ToUpper(s)
+	case strings.ToLower(chars) == chars && strings.ToUpper(chars) != chars:
+		return strings.ToLower(s)
+	}
+	return s
+}
+
+// crockfordCheckSymbol computes the Crockford check symbol of [data] as a big-endian integer
+func crockfordCheckSymbol(data []byte) byte {
+	mod := new(big.Int).Mod(new(big.Int).SetBytes(data), big.NewInt(37))
+	return (b32Presets["crockford"].alphabet + crockfordCheckSymbols)[mod.Int64()]
+}
+
 // decodeBase32 converts the inputBytes to a decoded string
 func decodeBase32(enc *base32.Encoding) (string, error) {
-	decoded, err := enc.DecodeString(string(inputBytes))
+	encoded := normalizeBase32(string(inputBytes), getB32Alphabet())
+
+	var check byte
+	if crockfordCheck {
+		if encoded == "" {
+			return "", errors.New("find check symbol")
+		}
+		check, encoded = encoded[len(encoded)-1], encoded[:len(encoded)-1]
+	}
+
+	decoded, err := enc.DecodeString(encoded)
 	if err != nil {
 		return "", errors.Wrap(err, "decode base32")
 	}
+	if crockfordCheck && crockfordCheckSymbol(decoded) != check {
+		return "", errors.New("verify check symbol")
+	}
 	return string(decoded), nil
 }
 
+// DecodeBase32Secret decodes a case-insensitive base32 secret as used in OTP seeds,
+// ignoring padding, spaces and dashes
+func DecodeBase32Secret(secret string) ([]byte, error) {
+	cleaned := strings.NewReplacer(" ", "", "-", "", "=", "").Replace(strings.TrimSpace(secret))
+	decoded, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.ToUpper(cleaned))
+	if err != nil {
+		return nil, errors.Wrap(err, "decode base32")
+	}
+	return decoded, nil
+}
+
 func init() {
 	fmtCmd.AddCommand(NewB32Cmd())
 }
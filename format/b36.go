@@ -0,0 +1,64 @@
+/*
+Copyright © 2021 SignorMercurio
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package format
+
+import (
+	"strings"
+
+	"github.com/eknkc/basex"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// b36Alphabet is the lowercase Base36 alphabet
+const b36Alphabet = "0123456789abcdefghijklmnopqrstuvwxyz"
+
+// NewB36Cmd represents the b36 command
+func NewB36Cmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "b36",
+		Short: "Base36 encode / decode",
+		Long: `Base36 encode / decode
+The input is encoded as a big-endian number, and decoding is case-insensitive.
+Example:
+	echo -n "hello" | att fmt -o out.txt b36 -e
+	att fmt -i in.txt b36 -d`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			enc, _ := basex.NewEncoding(b36Alphabet)
+
+			if encode {
+				Echo(enc.Encode(inputBytes))
+			} else if decode {
+				decoded, err := enc.Decode(strings.ToLower(strings.TrimSpace(string(inputBytes))))
+				if err != nil {
+					return errors.Wrap(err, "decode base36")
+				}
+				Echo(string(decoded))
+			} else {
+				NoActionSpecified()
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVarP(&encode, "encode", "e", false, "Encode to base36")
+	cmd.Flags().BoolVarP(&decode, "decode", "d", false, "Decode from base36")
+
+	return cmd
+}
+
+func init() {
+	fmtCmd.AddCommand(NewB36Cmd())
+}
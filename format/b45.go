@@ -0,0 +1,117 @@
+/*
+Copyright © 2021 SignorMercurio
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package format
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// b45Alphabet is the Base45 alphabet in RFC 9285
+const b45Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ $%*+-./:"
+
+// NewB45Cmd represents the b45 command
+func NewB45Cmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "b45",
+		Short: "Base45 encode / decode",
+		Long: `Base45 encode / decode
+Base45 (RFC 9285) is used in QR code payloads such as EU digital COVID certificates.
+Example:
+	echo -n "hello" | att fmt -o out.txt b45 -e
+	att fmt -i in.txt b45 -d`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if encode {
+				Echo(encodeBase45(inputBytes))
+			} else if decode {
+				decoded, err := decodeBase45(string(inputBytes))
+				if err != nil {
+					return errors.Wrap(err, "decode base45")
+				}
+				Echo(string(decoded))
+			} else {
+				NoActionSpecified()
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVarP(&encode, "encode", "e", false, "Encode to base45")
+	cmd.Flags().BoolVarP(&decode, "decode", "d", false, "Decode from base45")
+
+	return cmd
+}
+
+// encodeBase45 encodes every 2 bytes of [src] to 3 characters, and a trailing byte to 2
+func encodeBase45(src []byte) string {
+	var b strings.Builder
+	for i := 0; i < len(src); i += 2 {
+		if i+1 == len(src) {
+			v := int(src[i])
+			b.WriteByte(b45Alphabet[v%45])
+			b.WriteByte(b45Alphabet[v/45])
+			break
+		}
+		v := int(src[i])<<8 | int(src[i+1])
+		b.WriteByte(b45Alphabet[v%45])
+		b.WriteByte(b45Alphabet[v/45%45])
+		b.WriteByte(b45Alphabet[v/45/45])
+	}
+	return b.String()
+}
+
+// decodeBase45 decodes every 3 characters of [encoded] to 2 bytes, and 2 trailing characters to 1
+func decodeBase45(encoded string) ([]byte, error) {
+	encoded = strings.TrimRight(encoded, "\r\n")
+	if len(encoded)%3 == 1 {
+		return nil, errors.New("validate length: a group has only 1 character")
+	}
+
+	var decoded []byte
+	for i := 0; i < len(encoded); i += 3 {
+		v, weight := 0, 1
+		group := encoded[i:]
+		if len(group) > 3 {
+			group = group[:3]
+		}
+		for j := 0; j < len(group); j++ {
+			digit := strings.IndexByte(b45Alphabet, group[j])
+			if digit < 0 {
+				return nil, errors.New("recognize character " + string(group[j]))
+			}
+			v += digit * weight
+			weight *= 45
+		}
+
+		if len(group) == 2 {
+			if v > 0xff {
+				return nil, errors.New("validate group " + group + ": it overflows 8 bits")
+			}
+			decoded = append(decoded, byte(v))
+		} else {
+			if v > 0xffff {
+				return nil, errors.New("validate group " + group + ": it overflows 16 bits")
+			}
+			decoded = append(decoded, byte(v>>8), byte(v))
+		}
+	}
+	return decoded, nil
+}
+
+func init() {
+	fmtCmd.AddCommand(NewB45Cmd())
+}
@@ -17,33 +17,91 @@ package format
 
 import (
 	"encoding/ascii85"
+	"math/big"
+	"net"
+	"strings"
 
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
 
+var (
+	b85Alphabet string
+	b85Frame    bool
+	b85IPv6     bool
+)
+
+// b85Alphabets maps base85 variants other than ascii85 to their alphabets
+var b85Alphabets = map[string]string{
+	"z85":     "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ.-:+=^!/*?&<>()[]{}@%$#",
+	"rfc1924": "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz!#$%&()*+-;<=>?@^_`{|}~",
+}
+
 // NewB85Cmd represents the b85 command
 func NewB85Cmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "b85",
 		Short: "Base85 encode / decode",
 		Long: `Base85 encode / decode
+Alphabets: ascii85 (Adobe / btoa) / z85 (ZeroMQ) / rfc1924 (as in Python and git).
+A partial last group is padded and truncated in z85 and rfc1924.
+--ipv6 encodes an IPv6 address as a 128-bit number in the RFC 1924 alphabet.
 Example:
 	echo -n "hello" | att fmt -o out.txt b85 -e
-	att fmt -i in.txt b85 -d`,
+	att fmt -i in.txt b85 -d
+	echo -n "hello" | att fmt b85 -e --frame
+	echo -n "1080::8:800:200C:417A" | att fmt b85 -e --ipv6`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			if encode {
-				dstLen := ascii85.MaxEncodedLen(len(inputBytes))
-				encoded := make([]byte, dstLen)
+			if b85IPv6 {
+				b85Alphabet = "rfc1924"
+			}
+			chars, ok := b85Alphabets[b85Alphabet]
+			if !ok && b85Alphabet != "ascii85" {
+				return errors.New("recognize base85 alphabet " + b85Alphabet)
+			}
 
-				n := ascii85.Encode(encoded, inputBytes)
-				Echo(string(encoded[:n]))
-			} else if decode {
-				decoded := make([]byte, 4*len(inputBytes))
-				ndst, _, err := ascii85.Decode(decoded, inputBytes, true)
+			if encode {
+				var encoded string
+				var err error
+				switch {
+				case b85IPv6:
+					encoded, err = encodeIPv6Base85(string(inputBytes))
+				case ok:
+					encoded = encodeBase85(inputBytes, chars)
+				default:
+					dst := make([]byte, ascii85.MaxEncodedLen(len(inputBytes)))
+					encoded = string(dst[:ascii85.Encode(dst, inputBytes)])
+				}
 				if err != nil {
 					return err
 				}
-				Echo(string(decoded[:ndst]))
+				if b85Frame {
+					encoded = "<~" + encoded + "~>"
+				}
+				Echo(encoded)
+			} else if decode {
+				encoded := strings.Join(strings.Fields(string(inputBytes)), "")
+				encoded = strings.TrimSuffix(strings.TrimPrefix(encoded, "<~"), "~>")
+
+				var decoded []byte
+				var err error
+				switch {
+				case b85IPv6:
+					var ip string
+					ip, err = decodeIPv6Base85(encoded)
+					decoded = []byte(ip)
+				case ok:
+					decoded, err = decodeBase85(encoded, chars)
+				default:
+					decoded = make([]byte, 4*len(encoded))
+					var n int
+					n, _, err = ascii85.Decode(decoded, []byte(encoded), true)
+					decoded = decoded[:n]
+				}
+				if err != nil {
+					return errors.Wrap(err, "decode base85")
+				}
+				Echo(string(decoded))
 			} else {
 				NoActionSpecified()
 			}
@@ -52,10 +110,103 @@ Example:
 	}
 	cmd.Flags().BoolVarP(&encode, "encode", "e", false, "Encode to base85")
 	cmd.Flags().BoolVarP(&decode, "decode", "d", false, "Decode from base85")
+	cmd.Flags().StringVarP(&b85Alphabet, "alphabet", "a", "ascii85", "Alphabet for base85: ascii85 / z85 / rfc1924")
+	cmd.Flags().BoolVar(&b85Frame, "frame", false, "Wrap the encoded data in <~ ~> delimiters")
+	cmd.Flags().BoolVar(&b85IPv6, "ipv6", false, "Encode / decode an IPv6 address as in RFC 1924")
 
 	return cmd
 }
 
+// encodeBase85 encodes [src] in groups of 4 bytes with [chars],
+// truncating the padded last group
+func encodeBase85(src []byte, chars string) string {
+	var b strings.Builder
+	for i := 0; i < len(src); i += 4 {
+		var group [4]byte
+		n := copy(group[:], src[i:])
+		v := uint32(group[0])<<24 | uint32(group[1])<<16 | uint32(group[2])<<8 | uint32(group[3])
+
+		var digits [5]byte
+		for j := 4; j >= 0; j-- {
+			digits[j] = chars[v%85]
+			v /= 85
+		}
+		b.Write(digits[:n+1])
+	}
+	return b.String()
+}
+
+// decodeBase85 decodes [encoded] in groups of 5 characters with [chars],
+// padding the last group with the highest digit
+func decodeBase85(encoded string, chars string) ([]byte, error) {
+	var decoded []byte
+	for i := 0; i < len(encoded); i += 5 {
+		group := encoded[i:]
+		if len(group) > 5 {
+			group = group[:5]
+		}
+		if len(group) == 1 {
+			return nil, errors.New("validate length: a group has only 1 character")
+		}
+
+		var v uint64
+		for j := 0; j < 5; j++ {
+			digit := 84
+			if j < len(group) {
+				if digit = strings.IndexByte(chars, group[j]); digit < 0 {
+					return nil, errors.New("recognize character " + string(group[j]))
+				}
+			}
+			v = v*85 + uint64(digit)
+		}
+		if v > 0xffffffff {
+			return nil, errors.New("validate group " + group + ": it overflows 32 bits")
+		}
+		decoded = append(decoded, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+		decoded = decoded[:len(decoded)-5+len(group)]
+	}
+	return decoded, nil
+}
+
+// encodeIPv6Base85 encodes an IPv6 address as a 20-character base85 number
+func encodeIPv6Base85(addr string) (string, error) {
+	ip := net.ParseIP(strings.TrimSpace(addr))
+	if ip == nil || ip.To4() != nil {
+		return "", errors.New("parse IPv6 address " + addr)
+	}
+
+	chars := b85Alphabets["rfc1924"]
+	n := new(big.Int).SetBytes(ip.To16())
+	digits := make([]byte, 20)
+	mod := new(big.Int)
+	for i := len(digits) - 1; i >= 0; i-- {
+		n.DivMod(n, big.NewInt(85), mod)
+		digits[i] = chars[mod.Int64()]
+	}
+	return string(digits), nil
+}
+
+// decodeIPv6Base85 decodes a 20-character base85 number to an IPv6 address
+func decodeIPv6Base85(encoded string) (string, error) {
+	if len(encoded) != 20 {
+		return "", errors.New("validate length: an IPv6 address has 20 characters")
+	}
+
+	chars := b85Alphabets["rfc1924"]
+	n := new(big.Int)
+	for i := 0; i < len(encoded); i++ {
+		digit := strings.IndexByte(chars, encoded[i])
+		if digit < 0 {
+			return "", errors.New("recognize character " + string(encoded[i]))
+		}
+		n.Mul(n, big.NewInt(85)).Add(n, big.NewInt(int64(digit)))
+	}
+	if n.BitLen() > 128 {
+		return "", errors.New("validate address: it overflows 128 bits")
+	}
+	return net.IP(n.FillBytes(make([]byte, net.IPv6len))).String(), nil
+}
+
 func init() {
 	fmtCmd.AddCommand(NewB85Cmd())
 }
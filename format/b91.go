@@ -0,0 +1,125 @@
+/*
+Copyright © 2021 SignorMercurio
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package format
+
+import (
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// b91Alphabet is the basE91 alphabet
+const b91Alphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789!#$%&()*+,./:;<=>?@[]^_`{|}~\""
+
+// NewB91Cmd represents the b91 command
+func NewB91Cmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "b91",
+		Short: "Base91 encode / decode",
+		Long: `Base91 encode / decode
+Characters outside the basE91 alphabet are ignored when decoding.
+Example:
+	echo -n "hello" | att fmt -o out.txt b91 -e
+	att fmt -i in.txt b91 -d`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if encode {
+				Echo(encodeBase91(inputBytes))
+			} else if decode {
+				Echo(string(decodeBase91(string(inputBytes))))
+			} else {
+				NoActionSpecified()
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVarP(&encode, "encode", "e", false, "Encode to base91")
+	cmd.Flags().BoolVarP(&decode, "decode", "d", false, "Decode from base91")
+
+	return cmd
+}
+
+// encodeBase91 encodes [src] 13 or 14 bits at a time to 2 characters
+func encodeBase91(src []byte) string {
+	var b strings.Builder
+	var queue uint32
+	var bits uint
+	for _, c := range src {
+		queue |= uint32(c) << bits
+		bits += 8
+		if bits > 13 {
+			v := queue & 8191
+			if v > 88 {
+				queue >>= 13
+				bits -= 13
+			} else {
+				v = queue & 16383
+				queue >>= 14
+				bits -= 14
+			}
+			b.WriteByte(b91Alphabet[v%91])
+			b.WriteByte(b91Alphabet[v/91])
+		}
+	}
+
+	if bits > 0 {
+		b.WriteByte(b91Alphabet[queue%91])
+		if bits > 7 || queue > 90 {
+			b.WriteByte(b91Alphabet[queue/91])
+		}
+	}
+	return b.String()
+}
+
+// decodeBase91 decodes [encoded] 2 characters at a time to 13 or 14 bits
+func decodeBase91(encoded string) []byte {
+	var decoded []byte
+	var queue uint32
+	var bits uint
+	v := -1
+	for i := 0; i < len(encoded); i++ {
+		digit := strings.IndexByte(b91Alphabet, encoded[i])
+		if digit < 0 {
+			continue
+		}
+		if v < 0 {
+			v = digit
+			continue
+		}
+
+		v += digit * 91
+		queue |= uint32(v) << bits
+		if v&8191 > 88 {
+			bits += 13
+		} else {
+			bits += 14
+		}
+		for bits > 7 {
+			decoded = append(decoded, byte(queue))
+			queue >>= 8
+			bits -= 8
+		}
+		v = -1
+	}
+
+	if v >= 0 {
+		decoded = append(decoded, byte(queue|uint32(v)<<bits))
+	}
+	return decoded
+}
+
+func init() {
+	fmtCmd.AddCommand(NewB91Cmd())
+}
@@ -0,0 +1,374 @@
+/*
+Copyright © 2021 SignorMercurio
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package format
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/korean"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+	xunicode "golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/encoding/unicode/utf32"
+)
+
+var (
+	fromCharset string
+	toCharset   string
+	detect      bool
+	withBOM     bool
+	listCharset bool
+)
+
+// charsets maps canonical charset names to their encodings without and with BOM
+var charsets = map[string][2]encoding.Encoding{
+	"utf-8":        {xunicode.UTF8, xunicode.UTF8BOM},
+	"utf-16le":     {xunicode.UTF16(xunicode.LittleEndian, xunicode.IgnoreBOM), xunicode.UTF16(xunicode.LittleEndian, xunicode.UseBOM)},
+	"utf-16be":     {xunicode.UTF16(xunicode.BigEndian, xunicode.IgnoreBOM), xunicode.UTF16(xunicode.BigEndian, xunicode.UseBOM)},
+	"utf-32le":     {utf32.UTF32(utf32.LittleEndian, utf32.IgnoreBOM), utf32.UTF32(utf32.LittleEndian, utf32.UseBOM)},
+	"utf-32be":     {utf32.UTF32(utf32.BigEndian, utf32.IgnoreBOM), utf32.UTF32(utf32.BigEndian, utf32.UseBOM)},
+	"iso-8859-1":   {charmap.ISO8859_1},
+	"windows-1250": {charmap.Windows1250},
+	"windows-1251": {charmap.Windows1251},
+	"windows-1252": {charmap.Windows1252},
+	"windows-1253": {charmap.Windows1253},
+	"windows-1254": {charmap.Windows1254},
+	"windows-1255": {charmap.Windows1255},
+	"windows-1256": {charmap.Windows1256},
+	"windows-1257": {charmap.Windows1257},
+	"windows-1258": {charmap.Windows1258},
+	"gbk":          {simplifiedchinese.GBK},
+	"gb18030":      {simplifiedchinese.GB18030},
+	"big5":         {traditionalchinese.Big5},
+	"shift_jis":    {japanese.ShiftJIS},
+	"euc-jp":       {japanese.EUCJP},
+	"euc-kr":       {korean.EUCKR},
+	"koi8-r":       {charmap.KOI8R},
+	"koi8-u":       {charmap.KOI8U},
+}
+
+// charsetAliases maps normalized alternative names to canonical charset names
+var charsetAliases = map[string]string{
+	"utf8":    "utf-8",
+	"utf16":   "utf-16le",
+	"utf32":   "utf-32le",
+	"unicode": "utf-16le",
+	"latin1":  "iso-8859-1",
+	"l1":      "iso-8859-1",
+	"cp936":   "gbk",
+	"gb2312":  "gbk",
+	"cp950":   "big5",
+	"sjis":    "shift_jis",
+	"cp932":   "shift_jis",
+	"cp949":   "euc-kr",
+	"cp1251":  "windows-1251",
+	"cp1252":  "windows-1252",
+}
+
+// commonRunes are the most frequent characters of the languages the CJK charsets are used for
+var commonRunes = map[string]string{
+	"gb18030": "的一是不了在人有我他这个们中来上大为和国地到以说时要就出会可也你对生能而子那得于着下自之年过发后作里用道行所然家种事成方多经么去法学如都同现当没动面起看定天分还进好小部其些主样理心她本前开但因只从想实",
+	"big5":    "的一是不了在人有我他這個們中來上大為和國地到以說時要就出會可也你對生能而子那得於著下自之年過發後作裡用道行所然家種事成方多經麼去法學如都同現當沒動面起看定天分還進好小部其些主樣理心她本前開但因只從想實",
+	"euc-kr":  "이다는의에을가한고하지서로기도를은리사인대자있것수그정어일나해시게라아전보구부주장상국요제성적여우만된연들로면과내까할",
+}
+
+// detectCandidates are the legacy charsets tried when detecting, in order of preference on ties
+var detectCandidates = []string{"gb18030", "big5", "shift_jis", "euc-jp", "euc-kr", "windows-1251", "koi8-r", "windows-1252"}
+
+// NewChrCmd represents the chr command
+func NewChrCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "chr",
+		Short: "Character set conversion and detection",
+		Long: `Character set conversion and detection
+Supported charsets: utf-8, utf-16le, utf-16be, utf-32le, utf-32be, iso-8859-1, windows-1250 ~ windows-1258,
+gbk, gb18030, big5, shift_jis, euc-jp, euc-kr, koi8-r, koi8-u.
+A byte order mark in the input overrides the UTF-16 / UTF-32 byte order and is stripped.
+Use --from auto to detect the input charset before converting.
+Example:
+	att fmt -i gbk.txt chr --from gbk
+	echo -n "hello" | att fmt -o out.txt chr --to utf-16le --bom
+	att fmt -i dump.bin chr --detect`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if listCharset {
+				var names []string
+				for name := range charsets {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+				Echo(strings.Join(names, "\n"))
+				return nil
+			}
+
+			if detect {
+				Echo(detectCharset(inputBytes))
+				return nil
+			}
+
+			from := fromCharset
+			if from == "auto" {
+				from = detectCharset(inputBytes)
+			}
+			converted, err := convertCharset(inputBytes, from, toCharset)
+			if err != nil {
+				return err
+			}
+			Echo(string(converted))
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&fromCharset, "from", "f", "utf-8", "Charset of the input, or auto to detect it")
+	cmd.Flags().StringVarP(&toCharset, "to", "t", "utf-8", "Charset of the output")
+	cmd.Flags().BoolVar(&detect, "detect", false, "Detect the charset of the input")
+	cmd.Flags().BoolVarP(&withBOM, "bom", "b", false, "Write a byte order mark for Unicode output")
+	cmd.Flags().BoolVarP(&listCharset, "list", "l", false, "List supported charsets")
+
+	return cmd
+}
+
+// lookupCharset finds the canonical name of the charset [name]
+func lookupCharset(name string) (string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if _, ok := charsets[name]; ok {
+		return name, nil
+	}
+	normalized := strings.NewReplacer("-", "", "_", "", " ", "").Replace(name)
+	if canonical, ok := charsetAliases[normalized]; ok {
+		return canonical, nil
+	}
+	for canonical := range charsets {
+		if strings.NewReplacer("-", "", "_", "").Replace(canonical) == normalized {
+			return canonical, nil
+		}
+	}
+	return "", errors.New("recognize charset " + name)
+}
+
+// convertCharset converts [src] from charset [from] to charset [to]
+func convertCharset(src []byte, from string, to string) ([]byte, error) {
+	from, err := lookupCharset(from)
+	if err != nil {
+		return nil, err
+	}
+	to, err = lookupCharset(to)
+	if err != nil {
+		return nil, err
+	}
+
+	// decoders with BOM support honour and strip a leading BOM
+	decoder := charsets[from][0].NewDecoder()
+	if withBOMEnc := charsets[from][1]; withBOMEnc != nil {
+		decoder = withBOMEnc.NewDecoder()
+	}
+	decoded, err := decoder.Bytes(src)
+	if err != nil {
+		return nil, errors.Wrap(err, "decode "+from)
+	}
+
+	enc := charsets[to][0]
+	if withBOM && charsets[to][1] != nil {
+		enc = charsets[to][1]
+	}
+	encoded, err := enc.NewEncoder().Bytes(decoded)
+	if err != nil {
+		return nil, errors.Wrap(err, "encode to "+to)
+	}
+	return encoded, nil
+}
+
+// detectCharset guesses the charset of [src] from its BOM, NUL byte layout, UTF-8 validity and the plausibility of its decoded text
+func detectCharset(src []byte) string {
+	switch {
+	case bytes.HasPrefix(src, []byte{0xff, 0xfe, 0, 0}):
+		return "utf-32le"
+	case bytes.HasPrefix(src, []byte{0, 0, 0xfe, 0xff}):
+		return "utf-32be"
+	case bytes.HasPrefix(src, []byte{0xef, 0xbb, 0xbf}):
+		return "utf-8"
+	case bytes.HasPrefix(src, []byte{0xff, 0xfe}):
+		return "utf-16le"
+	case bytes.HasPrefix(src, []byte{0xfe, 0xff}):
+		return "utf-16be"
+	}
+
+	if charset := detectWideCharset(src); charset != "" {
+		return charset
+	}
+	if utf8.Valid(src) && charsetScore(src, "utf-8") >= 0 {
+		return "utf-8"
+	}
+
+	candidates := detectCandidates
+	if len(src)%2 == 0 {
+		candidates = append(candidates, "utf-16le", "utf-16be")
+	}
+	best, bestScore := "windows-1252", -1.0
+	for _, charset := range candidates {
+		if score := charsetScore(src, charset); score > bestScore {
+			best, bestScore = charset, score
+		}
+	}
+	return best
+}
+
+// detectWideCharset recognizes BOM-less UTF-16 / UTF-32 by where the NUL bytes of mostly-ASCII text fall
+func detectWideCharset(src []byte) string {
+	if len(src) < 2 || len(src)%2 != 0 {
+		return ""
+	}
+	var zeros [4]int
+	for i, b := range src {
+		if b == 0 {
+			zeros[i%4]++
+		}
+	}
+	units := len(src) / 4
+	if len(src)%4 == 0 && units > 0 {
+		if zeros[1]+zeros[2]+zeros[3] >= units*3*9/10 && zeros[0] < units/2 {
+			return "utf-32le"
+		}
+		if zeros[0]+zeros[1]+zeros[2] >= units*3*9/10 && zeros[3] < units/2 {
+			return "utf-32be"
+		}
+	}
+
+	half := len(src) / 2
+	even, odd := zeros[0]+zeros[2], zeros[1]+zeros[3]
+	if odd >= half*6/10 && even < half/10 {
+		return "utf-16le"
+	}
+	if even >= half*6/10 && odd < half/10 {
+		return "utf-16be"
+	}
+	return ""
+}
+
+// charsetScore rates how plausible the text of [src] decoded as [charset] is, per input byte
+func charsetScore(src []byte, charset string) float64 {
+	enc := charsets[charset][0]
+	decoded, err := enc.NewDecoder().String(string(src))
+	if err != nil || strings.ContainsRune(decoded, utf8.RuneError) {
+		return -1
+	}
+
+	encoder := enc.NewEncoder()
+	runes := []rune(decoded)
+	score := 0.0
+	for i, r := range runes {
+		// weigh each character by the number of bytes it takes in the input
+		width := 1
+		if encoded, err := encoder.String(string(r)); err == nil {
+			width = len(encoded)
+		}
+
+		weight := runeWeight(r, charset)
+		if r < utf8.RuneSelf {
+			weight = 0
+			if unicode.IsControl(r) && !unicode.IsSpace(r) {
+				weight = -2
+			}
+		} else if weight > 0 && unicode.IsLetter(r) && !unicode.Is(unicode.Latin, r) &&
+			(i > 0 && isASCIILetter(runes[i-1]) || i+1 < len(runes) && isASCIILetter(runes[i+1])) {
+			// words rarely mix Latin with other scripts
+			weight = -1
+		}
+		score += weight * float64(width)
+	}
+	return score / float64(len(src))
+}
+
+// isASCIILetter checks whether [r] is an ASCII letter
+func isASCIILetter(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z'
+}
+
+// runeWeight rates how likely the character [r] is to appear in text encoded in [charset]
+func runeWeight(r rune, charset string) float64 {
+	switch {
+	case unicode.IsControl(r) || unicode.Is(unicode.Co, r):
+		return -2
+	case strings.ContainsRune(commonRunes[charset], r):
+		return 2
+	case r >= 0x3000 && r <= 0x303f, r >= 0xff01 && r <= 0xff5e:
+		// CJK punctuation and fullwidth forms
+		return 0.5
+	}
+
+	switch charset {
+	case "gb18030", "big5":
+		if unicode.Is(unicode.Han, r) {
+			return 0.5
+		}
+	case "shift_jis", "euc-jp":
+		switch {
+		case unicode.Is(unicode.Hiragana, r):
+			return 2
+		case unicode.Is(unicode.Katakana, r) && r < 0xff00:
+			return 1
+		case unicode.Is(unicode.Han, r):
+			return 0.5
+		}
+	case "euc-kr":
+		switch {
+		case unicode.Is(unicode.Hangul, r):
+			return 0.5
+		case unicode.Is(unicode.Han, r):
+			return 0.1
+		}
+	case "windows-1251", "koi8-r":
+		// running text is mostly lowercase, which sits in different byte ranges in the two charsets
+		if unicode.Is(unicode.Cyrillic, r) {
+			if unicode.IsLower(r) {
+				return 1
+			}
+			return 0.2
+		}
+	case "utf-8", "utf-16le", "utf-16be":
+		// misread bytes land on random, mostly rare ideographs and syllables
+		switch {
+		case strings.ContainsRune(commonRunes["gb18030"]+commonRunes["big5"]+commonRunes["euc-kr"], r),
+			unicode.Is(unicode.Hiragana, r):
+			return 2
+		case unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hangul, r):
+			return 0
+		case unicode.In(r, unicode.Latin, unicode.Cyrillic, unicode.Greek, unicode.Katakana):
+			return 1
+		case unicode.IsPunct(r):
+			return 0.5
+		}
+	case "windows-1252":
+		if unicode.IsLetter(r) {
+			return 1
+		}
+		if unicode.IsPunct(r) {
+			return 0.5
+		}
+	}
+	return -1
+}
+
+func init() {
+	fmtCmd.AddCommand(NewChrCmd())
+}
@@ -0,0 +1,594 @@
+/*
+Copyright © 2021 SignorMercurio
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package format
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var (
+	escLang    string
+	arrayLang  string
+	arrayName  string
+	arrayWidth int
+)
+
+// escLangs are the languages of string literals
+var escLangs = map[string]bool{
+	"c": true, "go": true, "python": true, "pybytes": true, "js": true, "java": true, "json": true,
+	"sh": true, "bash": true, "ps": true, "sql": true, "regex": true, "csv": true,
+}
+
+// simpleEscapes maps control characters to the escapes shared by C-like languages
+var simpleEscapes = map[byte]string{
+	'\a': `\a`,
+	'\b': `\b`,
+	'\f': `\f`,
+	'\n': `\n`,
+	'\r': `\r`,
+	'\t': `\t`,
+	'\v': `\v`,
+}
+
+// NewEscCmd represents the esc command
+func NewEscCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "esc",
+		Short: "Language-specific string escaping and byte array literals",
+		Long: `Language-specific string escaping and byte array literals
+Languages: c, go, python, pybytes, js, java, json, sh ('...'), bash ($'...'), ps (PowerShell), sql, regex, csv
+Escaping outputs a complete literal, and unescaping accepts one with or without its quotes.
+Array languages: c, go, python, rust
+Example:
+	echo -n "it's" | att fmt esc -e -l sh
+	att fmt -i in.txt esc -d -l c
+	att fmt -i shellcode.bin esc --array c --name sc
+	att fmt -i shellcode.bin esc --array go --delim "," -w 0`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if arrayLang != "" {
+				literal, err := byteArray(inputBytes)
+				if err != nil {
+					return err
+				}
+				Echo(literal)
+			} else if !escLangs[escLang] {
+				return errors.New("recognize language " + escLang)
+			} else if encode {
+				escaped, err := escapeString(inputBytes)
+				if err != nil {
+					return err
+				}
+				Echo(escaped)
+			} else if decode {
+				unescaped, err := unescapeString(string(inputBytes))
+				if err != nil {
+					return err
+				}
+				Echo(string(unescaped))
+			} else {
+				NoActionSpecified()
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVarP(&encode, "encode", "e", false, "Escape to a string literal")
+	cmd.Flags().BoolVarP(&decode, "decode", "d", false, "Unescape a string literal")
+	cmd.Flags().StringVarP(&escLang, "lang", "l", "c", "Language of the string literal")
+	cmd.Flags().StringVarP(&arrayLang, "array", "a", "", "Emit a byte array literal in the language: c / go / python / rust")
+	cmd.Flags().StringVarP(&arrayName, "name", "n", "buf", "Variable name of the byte array")
+	cmd.Flags().IntVarP(&arrayWidth, "width", "w", 12, "Bytes per line of the byte array, 0 for a single line")
+	cmd.Flags().StringVar(&delim, "delim", "", `Delimiter between bytes of the array, ", " by default. e.g. ",", "\n", etc.`)
+
+	return cmd
+}
+
+// escapeString escapes [src] to a string literal of the chosen language
+func escapeString(src []byte) (string, error) {
+	switch escLang {
+	case "c":
+		return `"` + escapeBytes(src, `"`, true) + `"`, nil
+	case "pybytes":
+		return `b'` + escapeBytes(src, `'`, false) + `'`, nil
+	case "bash":
+		escaped := escapeBytes(src, `'`, false)
+		return `$'` + strings.ReplaceAll(escaped, `\x1b`, `\e`) + `'`, nil
+	case "go":
+		return strconv.Quote(string(src)), nil
+	case "sh":
+		return `'` + strings.ReplaceAll(string(src), `'`, `'\''`) + `'`, nil
+	case "sql":
+		return `'` + strings.ReplaceAll(string(src), `'`, `''`) + `'`, nil
+	case "regex":
+		return regexp.QuoteMeta(string(src)), nil
+	case "csv":
+		var buf bytes.Buffer
+		w := csv.NewWriter(&buf)
+		if err := w.Write([]string{string(src)}); err != nil {
+			return "", errors.Wrap(err, "escape CSV field")
+		}
+		w.Flush()
+		return strings.TrimSuffix(buf.String(), "\n"), nil
+	}
+
+	// the remaining languages have Unicode strings
+	if !utf8.Valid(src) {
+		return "", errors.New("escape invalid UTF-8 to a " + escLang + " string, use a byte-oriented language instead")
+	}
+	switch escLang {
+	case "python":
+		return `'` + escapeRunes(string(src), `'`, pythonRune) + `'`, nil
+	case "js":
+		return `"` + escapeRunes(string(src), `"`, jsRune) + `"`, nil
+	case "java":
+		return `"` + escapeRunes(string(src), `"`, javaRune) + `"`, nil
+	case "ps":
+		return `"` + escapeRunes(string(src), "", psRune) + `"`, nil
+	case "json":
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(string(src)); err != nil {
+			return "", errors.Wrap(err, "escape JSON string")
+		}
+		return strings.TrimSuffix(buf.String(), "\n"), nil
+	}
+	return "", errors.New("recognize language " + escLang)
+}
+
+// escapeBytes escapes [src] byte by byte with \xHH for non-printable ASCII, splitting the literal
+// when a hex digit follows a hex escape if [split] is set
+func escapeBytes(src []byte, quote string, split bool) string {
+	var b strings.Builder
+	hexEscaped := false
+	for _, c := range src {
+		if escape, ok := simpleEscapes[c]; ok {
+			b.WriteString(escape)
+			hexEscaped = false
+			continue
+		}
+		if c < 0x20 || c > 0x7e {
+			fmt.Fprintf(&b, `\x%02x`, c)
+			hexEscaped = true
+			continue
+		}
+
+		// \x consumes every following hex digit in C
+		if split && hexEscaped && strings.IndexByte("0123456789abcdefABCDEF", c) >= 0 {
+			b.WriteString(quote + quote)
+		}
+		if c == '\\' || string(c) == quote {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(c)
+		hexEscaped = false
+	}
+	return b.String()
+}
+
+// escapeRunes escapes [src] rune by rune, using [escapeRune] for characters that need escaping
+func escapeRunes(src string, quote string, escapeRune func(r rune) string) string {
+	var b strings.Builder
+	for _, r := range src {
+		switch {
+		case r == '\\' && escLang != "ps" || string(r) == quote:
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x80 && simpleEscapes[byte(r)] != "" && escLang != "ps" &&
+			!(r == '\a' && escLang != "python") && !(r == '\v' && escLang == "java"):
+			b.WriteString(simpleEscapes[byte(r)])
+		default:
+			b.WriteString(escapeRune(r))
+		}
+	}
+	return b.String()
+}
+
+// pythonRune escapes non-printable characters for a Python str
+func pythonRune(r rune) string {
+	switch {
+	case unicode.IsPrint(r):
+		return string(r)
+	case r < 0x100:
+		return fmt.Sprintf(`\x%02x`, r)
+	case r > 0xffff:
+		return fmt.Sprintf(`\U%08x`, r)
+	}
+	return fmt.Sprintf(`\u%04x`, r)
+}
+
+// jsRune escapes control and non-ASCII characters for a JavaScript string
+func jsRune(r rune) string {
+	if r < 0x20 || r == 0x7f {
+		return fmt.Sprintf(`\x%02x`, r)
+	}
+	return javaRune(r)
+}
+
+// javaRune escapes control and non-ASCII characters as UTF-16 code units for a Java string
+func javaRune(r rune) string {
+	switch {
+	case r >= 0x20 && r < 0x7f:
+		return string(r)
+	case r > 0xffff:
+		r1, r2 := utf16.EncodeRune(r)
+		return fmt.Sprintf(`\u%04x\u%04x`, r1, r2)
+	}
+	return fmt.Sprintf(`\u%04x`, r)
+}
+
+// psRune escapes special and control characters with backticks for a double-quoted PowerShell string
+func psRune(r rune) string {
+	switch r {
+	case '`', '"', '$':
+		return "`" + string(r)
+	case 0:
+		return "`0"
+	case '\a':
+		return "`a"
+	case '\b':
+		return "`b"
+	case 0x1b:
+		return "`e"
+	case '\f':
+		return "`f"
+	case '\n':
+		return "`n"
+	case '\r':
+		return "`r"
+	case '\t':
+		return "`t"
+	case '\v':
+		return "`v"
+	}
+	if r < 0x20 || r == 0x7f {
+		return fmt.Sprintf("`u{%x}", r)
+	}
+	return string(r)
+}
+
+// unescapeString parses a string literal of the chosen language
+func unescapeString(src string) ([]byte, error) {
+	switch escLang {
+	case "c", "java":
+		return unescapeBackslash(trimQuotes(src, `"`), escLang)
+	case "js":
+		return unescapeBackslash(trimQuotes(trimQuotes(src, `"`), `'`), escLang)
+	case "python", "pybytes":
+		src = strings.TrimPrefix(strings.TrimPrefix(src, "b"), "B")
+		return unescapeBackslash(trimQuotes(trimQuotes(src, `"`), `'`), escLang)
+	case "go":
+		if src == "" || !strings.ContainsAny(src[:1], "\"`'") {
+			src = `"` + src + `"`
+		}
+		unquoted, err := strconv.Unquote(src)
+		if err != nil {
+			return nil, errors.Wrap(err, "unquote Go string")
+		}
+		return []byte(unquoted), nil
+	case "json":
+		if !strings.HasPrefix(src, `"`) {
+			src = `"` + src + `"`
+		}
+		var unquoted string
+		if err := json.Unmarshal([]byte(src), &unquoted); err != nil {
+			return nil, errors.Wrap(err, "unquote JSON string")
+		}
+		return []byte(unquoted), nil
+	case "sh", "bash":
+		return unquoteShell(src)
+	case "ps":
+		if strings.HasPrefix(src, `'`) {
+			return []byte(strings.ReplaceAll(trimQuotes(src, `'`), `''`, `'`)), nil
+		}
+		return unescapePowerShell(trimQuotes(src, `"`))
+	case "sql":
+		return []byte(strings.ReplaceAll(trimQuotes(src, `'`), `''`, `'`)), nil
+	case "regex":
+		return unescapeBackslash(src, escLang)
+	case "csv":
+		record, err := csv.NewReader(strings.NewReader(src)).Read()
+		if err != nil {
+			return nil, errors.Wrap(err, "parse CSV field")
+		}
+		return []byte(strings.Join(record, "\n")), nil
+	}
+	return nil, errors.New("recognize language " + escLang)
+}
+
+// trimQuotes removes the [quote] surrounding [s], if any
+func trimQuotes(s string, quote string) string {
+	if len(s) >= 2 && strings.HasPrefix(s, quote) && strings.HasSuffix(s, quote) {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// unescapeBackslash parses backslash escapes, joining adjacent C literals and UTF-16 surrogate pairs
+func unescapeBackslash(s string, lang string) ([]byte, error) {
+	var out []byte
+	var pendingHigh rune
+	flushHigh := func() {
+		if pendingHigh != 0 {
+			out = append(out, string(unicode.ReplacementChar)...)
+			pendingHigh = 0
+		}
+	}
+	for i := 0; i < len(s); i++ {
+		// adjacent C literals are concatenated
+		if lang == "c" && strings.HasPrefix(s[i:], `""`) {
+			i++
+			continue
+		}
+		if s[i] != '\\' || i+1 == len(s) {
+			flushHigh()
+			out = append(out, s[i])
+			continue
+		}
+
+		i++
+		c := s[i]
+		var r rune = -1
+		switch {
+		case c == 'x' && lang == "js" && strings.HasPrefix(s[i+1:], "{"):
+			// not valid JavaScript, kept literally
+			out = append(out, c)
+			continue
+		case c == 'x':
+			digits := hexPrefix(s[i+1:], 2)
+			if lang == "c" {
+				digits = hexPrefix(s[i+1:], 8)
+			}
+			if digits == "" {
+				return nil, errors.New("parse \\x escape at offset " + strconv.Itoa(i-1))
+			}
+			v, _ := strconv.ParseUint(digits, 16, 64)
+			i += len(digits)
+			if unicodeString(lang) {
+				r = rune(v)
+				break
+			}
+			flushHigh()
+			out = append(out, byte(v))
+			continue
+		case c == 'u' && lang == "js" && strings.HasPrefix(s[i+1:], "{"):
+			end := strings.IndexByte(s[i:], '}')
+			if end < 0 {
+				return nil, errors.New("parse \\u{} escape at offset " + strconv.Itoa(i-1))
+			}
+			v, err := strconv.ParseUint(s[i+2:i+end], 16, 32)
+			if err != nil {
+				return nil, errors.Wrap(err, "parse \\u{} escape")
+			}
+			r = rune(v)
+			i += end
+		case (c == 'u' || c == 'U') && (lang == "pybytes" || lang == "regex"):
+			// bytes literals and regexes have no \u escape, so it is kept literally
+			flushHigh()
+			out = append(out, '\\', c)
+			continue
+		case c == 'u' || c == 'U' && lang != "java" && lang != "js":
+			size := 4
+			if c == 'U' {
+				size = 8
+			}
+			digits := hexPrefix(s[i+1:], size)
+			if len(digits) != size {
+				return nil, errors.New("parse \\" + string(c) + " escape at offset " + strconv.Itoa(i-1))
+			}
+			v, _ := strconv.ParseUint(digits, 16, 32)
+			r = rune(v)
+			i += size
+		case c >= '0' && c <= '7' && lang != "regex":
+			j := i
+			for j < len(s) && j < i+3 && s[j] >= '0' && s[j] <= '7' {
+				j++
+			}
+			v, _ := strconv.ParseUint(s[i:j], 8, 16)
+			i = j - 1
+			if unicodeString(lang) {
+				r = rune(v)
+				break
+			}
+			flushHigh()
+			out = append(out, byte(v))
+			continue
+		case c == 'e' && lang == "bash":
+			r = 0x1b
+		default:
+			r = rune(c)
+			for b, escape := range simpleEscapes {
+				if escape[1] == c {
+					r = rune(b)
+				}
+			}
+		}
+
+		// combine UTF-16 surrogate pairs from \u escapes
+		switch {
+		case utf16.IsSurrogate(r) && r < 0xdc00:
+			flushHigh()
+			pendingHigh = r
+		case utf16.IsSurrogate(r) && pendingHigh != 0:
+			out = append(out, string(utf16.DecodeRune(pendingHigh, r))...)
+			pendingHigh = 0
+		default:
+			flushHigh()
+			out = append(out, string(r)...)
+		}
+	}
+	flushHigh()
+	return out, nil
+}
+
+// unicodeString checks whether \x and octal escapes of [lang] stand for code points rather than bytes
+func unicodeString(lang string) bool {
+	return lang == "js" || lang == "python" || lang == "java" || lang == "regex"
+}
+
+// hexPrefix gets up to [max] leading hex digits of [s]
+func hexPrefix(s string, max int) string {
+	n := 0
+	for n < len(s) && n < max && strings.IndexByte("0123456789abcdefABCDEF", s[n]) >= 0 {
+		n++
+	}
+	return s[:n]
+}
+
+// unquoteShell parses a POSIX shell word with single, double and $'...' quoting
+func unquoteShell(s string) ([]byte, error) {
+	var out []byte
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\'':
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end < 0 {
+				return nil, errors.New("find closing single quote")
+			}
+			out = append(out, s[i+1:i+1+end]...)
+			i += end + 1
+		case strings.HasPrefix(s[i:], "$'"):
+			j := i + 2
+			for ; j < len(s) && s[j] != '\''; j++ {
+				if s[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(s) {
+				return nil, errors.New("find closing single quote")
+			}
+			unescaped, err := unescapeBackslash(s[i+2:j], "bash")
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, unescaped...)
+			i = j
+		case s[i] == '"':
+			j := i + 1
+			for ; j < len(s) && s[j] != '"'; j++ {
+				if s[j] == '\\' && j+1 < len(s) && strings.IndexByte("$`\"\\\n", s[j+1]) >= 0 {
+					j++
+				}
+				out = append(out, s[j])
+			}
+			if j >= len(s) {
+				return nil, errors.New("find closing double quote")
+			}
+			i = j
+		case s[i] == '\\' && i+1 < len(s):
+			i++
+			out = append(out, s[i])
+		default:
+			out = append(out, s[i])
+		}
+	}
+	return out, nil
+}
+
+// unescapePowerShell parses backtick escapes of a double-quoted PowerShell string
+func unescapePowerShell(s string) ([]byte, error) {
+	escapes := map[byte]byte{'0': 0, 'a': '\a', 'b': '\b', 'e': 0x1b, 'f': '\f', 'n': '\n', 'r': '\r', 't': '\t', 'v': '\v'}
+	var out []byte
+	for i := 0; i < len(s); i++ {
+		if s[i] != '`' || i+1 == len(s) {
+			out = append(out, s[i])
+			continue
+		}
+
+		i++
+		if strings.HasPrefix(s[i:], "u{") {
+			end := strings.IndexByte(s[i:], '}')
+			if end < 0 {
+				return nil, errors.New("parse `u{} escape")
+			}
+			v, err := strconv.ParseUint(s[i+2:i+end], 16, 32)
+			if err != nil {
+				return nil, errors.Wrap(err, "parse `u{} escape")
+			}
+			out = append(out, string(rune(v))...)
+			i += end
+		} else if c, ok := escapes[s[i]]; ok {
+			out = append(out, c)
+		} else {
+			out = append(out, s[i])
+		}
+	}
+	return out, nil
+}
+
+// byteArray emits [src] as a byte array literal of the chosen language
+func byteArray(src []byte) (string, error) {
+	separator := string(getDelimiter())
+	if separator == "" {
+		separator = ", "
+	}
+
+	var lines []string
+	step := arrayWidth
+	if step <= 0 {
+		step = len(src)
+	}
+	for i := 0; i < len(src); i += step {
+		chunk := src[i:]
+		if len(chunk) > step {
+			chunk = chunk[:step]
+		}
+		var items []string
+		for _, c := range chunk {
+			if arrayLang == "python" {
+				items = append(items, fmt.Sprintf(`\x%02x`, c))
+			} else {
+				items = append(items, fmt.Sprintf("0x%02x", c))
+			}
+		}
+		if arrayLang == "python" {
+			lines = append(lines, fmt.Sprintf(`%s += b"%s"`, arrayName, strings.Join(items, "")))
+		} else {
+			lines = append(lines, strings.Join(items, separator))
+		}
+	}
+
+	body := strings.Join(lines, "")
+	if arrayWidth > 0 && len(lines) > 0 {
+		body = "\n\t" + strings.Join(lines, strings.TrimRight(separator, " ")+"\n\t") + ",\n"
+	}
+	switch arrayLang {
+	case "c":
+		return fmt.Sprintf("unsigned char %s[] = {%s};\nunsigned int %s_len = %d;", arrayName, body, arrayName, len(src)), nil
+	case "go":
+		return fmt.Sprintf("%s := []byte{%s}", arrayName, body), nil
+	case "rust":
+		return fmt.Sprintf("let %s: [u8; %d] = [%s];", arrayName, len(src), body), nil
+	case "python":
+		return strings.Join(append([]string{arrayName + ` = b""`}, lines...), "\n"), nil
+	}
+	return "", errors.New("recognize array language " + arrayLang)
+}
+
+func init() {
+	fmtCmd.AddCommand(NewEscCmd())
+}
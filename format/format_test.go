@@ -2,6 +2,9 @@ package format
 
 import (
 	"io"
+	"os"
+	"path/filepath"
+	"regexp"
 	"testing"
 
 	"github.com/SignorMercurio/attrezzi/cmd"
@@ -30,6 +33,16 @@ func exec(args ...string) {
 		NewB58Cmd(),
 		NewBsxCmd(),
 		NewB85Cmd(),
+		NewB45Cmd(),
+		NewB91Cmd(),
+		NewB36Cmd(),
+		NewB100Cmd(),
+		NewQpCmd(),
+		NewUuCmd(),
+		NewYencCmd(),
+		NewMimeCmd(),
+		NewChrCmd(),
+		NewEscCmd(),
 	)
 	rootCmd.AddCommand(fmtCmd)
 
@@ -107,6 +120,26 @@ func TestB32(t *testing.T) {
 		// custom padding
 		{Cmd: []string{in, "b32", "-e", "-p", "!"}, Dst: "JBSWY3DPEDSLRFXHSWGCAMJSGM!!!!!!"},
 		{Cmd: []string{out, "b32", "-d", "-p", "!"}, Dst: src},
+		// presets
+		{Cmd: []string{in, "b32", "-e", "-a", "crockford"}, Dst: "91JPRV3F43JBH5Q7JP620C9J6C"},
+		{Cmd: []string{out, "b32", "-d", "-a", "crockford"}, Dst: src},
+		{Cmd: []string{in, "b32", "-e", "-a", "z"}, Dst: "jb1sa5dxrd1mtfz81sgnycj1gc"},
+		{Cmd: []string{out, "b32", "-d", "-a", "z"}, Dst: src},
+		{Cmd: []string{in, "b32", "-e", "-a", "geohash"}, Dst: "91kqsv3g43kcj5r7kq620d9k6d"},
+		{Cmd: []string{out, "b32", "-d", "-a", "geohash"}, Dst: src},
+		{Cmd: []string{in, "b32", "-e", "-a", "wordsafe"}, Dst: "F3Wgjq5Q65WHV7h9Wg842JFW8J"},
+		{Cmd: []string{out, "b32", "-d", "-a", "wordsafe"}, Dst: src},
+		{Cmd: []string{in, "b32", "-e", "-a", "z", "-p", "="}, Dst: "jb1sa5dxrd1mtfz81sgnycj1gc======"},
+		// crockford check symbol
+		{Cmd: []string{in, "b32", "-e", "-a", "crockford", "--check"}, Dst: "91JPRV3F43JBH5Q7JP620C9J6C2"},
+		{Cmd: []string{out, "b32", "-d", "-a", "crockford", "--check"}, Dst: src},
+		{Cmd: []string{"./testdata/in_b32_crockford.txt", "b32", "-d", "-a", "crockford", "--check"}, Dst: src},
+		{Cmd: []string{in, "b32", "-e", "-a", "crockford"}, Dst: "*"},
+		{Cmd: []string{out, "b32", "-d", "-a", "crockford", "--check"}, Dst: ""},
+		{Cmd: []string{in, "b32", "-e", "--check"}, Dst: ""},
+		// case-insensitive
+		{Cmd: []string{in, "b32", "-e", "-a", "hex"}, Dst: "91IMOR3F43IBH5N7IM620C9I6C======"},
+		{Cmd: []string{out, "b32", "-d", "-a", "0123456789abcdefghijklmnopqrstuv"}, Dst: src},
 		// decode fail
 		{Cmd: []string{in, "b32", "-d"}, Dst: ""},
 		// no action
@@ -146,6 +179,21 @@ func TestB85(t *testing.T) {
 		// std
 		{Cmd: []string{in, "b85", "-e"}, Dst: "87cURD]n,NQKONl+>GW-"},
 		{Cmd: []string{out, "b85", "-d"}, Dst: src},
+		// btoa framing
+		{Cmd: []string{in, "b85", "-e", "--frame"}, Dst: "<~87cURD]n,NQKONl+>GW-~>"},
+		{Cmd: []string{out, "b85", "-d"}, Dst: src},
+		// z85
+		{Cmd: []string{in, "b85", "-e", "-a", "z85"}, Dst: "nm=QNzY[bJMGKJ(atCSc"},
+		{Cmd: []string{out, "b85", "-d", "-a", "z85"}, Dst: src},
+		// rfc1924
+		{Cmd: []string{in, "b85", "-e", "-a", "rfc1924"}, Dst: "NM&qnZy@Bjmgkj>ATcsC"},
+		{Cmd: []string{out, "b85", "-d", "-a", "rfc1924"}, Dst: src},
+		{Cmd: []string{"./testdata/in_ipv6.txt", "b85", "-e", "--ipv6"}, Dst: "4)+k&C#VzJ4br>0wv%Yp"},
+		{Cmd: []string{out, "b85", "-d", "--ipv6"}, Dst: "1080::8:800:200c:417a"},
+		{Cmd: []string{in, "b85", "-e", "--ipv6"}, Dst: ""},
+		{Cmd: []string{in, "b85", "-d", "--ipv6"}, Dst: ""},
+		// invalid alphabet
+		{Cmd: []string{in, "b85", "-e", "-a", "btoa"}, Dst: ""},
 		// decode fail
 		{Cmd: []string{in, "b85", "-d"}, Dst: ""},
 		// no action
@@ -158,6 +206,250 @@ func TestB85(t *testing.T) {
 	}
 }
 
+func TestB45(t *testing.T) {
+	var tests = []test.Test{
+		{Cmd: []string{in, "b45", "-e"}, Dst: "%69 VD82E7-SL3JY+I634QF6"},
+		{Cmd: []string{out, "b45", "-d"}, Dst: src},
+		// decode fail
+		{Cmd: []string{in, "b45", "-d"}, Dst: ""},
+		// no action
+		{Cmd: []string{in, "b45"}, Dst: ""},
+	}
+
+	for _, tst := range tests {
+		exec(tst.Cmd...)
+		test.CheckResult(out, tst.Dst, t)
+	}
+}
+
+func TestB91(t *testing.T) {
+	var tests = []test.Test{
+		{Cmd: []string{in, "b91", "-e"}, Dst: ">OwJh>TXug!32zoLQztE"},
+		{Cmd: []string{out, "b91", "-d"}, Dst: src},
+		// no action
+		{Cmd: []string{in, "b91"}, Dst: ""},
+	}
+
+	for _, tst := range tests {
+		exec(tst.Cmd...)
+		test.CheckResult(out, tst.Dst, t)
+	}
+}
+
+func TestB36(t *testing.T) {
+	var tests = []test.Test{
+		{Cmd: []string{in, "b36", "-e"}, Dst: "4aaozkf3wqk6s930kcl91hjjn"},
+		{Cmd: []string{out, "b36", "-d"}, Dst: src},
+		// decode fail
+		{Cmd: []string{in, "b36", "-d"}, Dst: ""},
+		// no action
+		{Cmd: []string{in, "b36"}, Dst: ""},
+	}
+
+	for _, tst := range tests {
+		exec(tst.Cmd...)
+		test.CheckResult(out, tst.Dst, t)
+	}
+}
+
+func TestB100(t *testing.T) {
+	var tests = []test.Test{
+		{Cmd: []string{in, "b100", "-e"}, Dst: "🐿👜👣👣👦🐗📛💯💍📞💌💃🐗🐨🐩🐪"},
+		{Cmd: []string{out, "b100", "-d"}, Dst: src},
+		// decode fail
+		{Cmd: []string{in, "b100", "-d"}, Dst: ""},
+		// no action
+		{Cmd: []string{in, "b100"}, Dst: ""},
+	}
+
+	for _, tst := range tests {
+		exec(tst.Cmd...)
+		test.CheckResult(out, tst.Dst, t)
+	}
+}
+
+func TestQp(t *testing.T) {
+	var tests = []test.Test{
+		{Cmd: []string{in, "qp", "-e"}, Dst: "Hello =E4=B8=96=E7=95=8C 123"},
+		{Cmd: []string{out, "qp", "-d"}, Dst: src},
+		{Cmd: []string{in, "qp", "-e", "-b"}, Dst: "Hello =E4=B8=96=E7=95=8C 123"},
+		// invalid escapes are kept as is
+		{Cmd: []string{"./testdata/in_url.txt", "qp", "-d"}, Dst: "https://www.example.com/a/b/?c=d&e=f#g中文"},
+		// no action
+		{Cmd: []string{in, "qp"}, Dst: ""},
+	}
+
+	for _, tst := range tests {
+		exec(tst.Cmd...)
+		test.CheckResult(out, tst.Dst, t)
+	}
+}
+
+func TestUu(t *testing.T) {
+	var tests = []test.Test{
+		{Cmd: []string{in, "uu", "-e"}, Dst: "begin 644 data\n02&5L;&\\@Y+B6YY6,(#$R,P``\n`\nend\n"},
+		{Cmd: []string{out, "uu", "-d"}, Dst: src},
+		// xxencode
+		{Cmd: []string{in, "uu", "-e", "-x", "-n", "in.txt", "-m", "600"}, Dst: "begin 600 in.txt\nEG4JgP4wUt9WKttKA612mAk++\n+\nend\n"},
+		{Cmd: []string{out, "uu", "-d", "-x"}, Dst: src},
+		// decode fail
+		{Cmd: []string{in, "uu", "-d"}, Dst: ""},
+		// no action
+		{Cmd: []string{in, "uu"}, Dst: ""},
+	}
+
+	for _, tst := range tests {
+		exec(tst.Cmd...)
+		test.CheckResult(out, tst.Dst, t)
+	}
+}
+
+func TestYenc(t *testing.T) {
+	var tests = []test.Test{
+		{Cmd: []string{in, "yenc", "-e", "-n", "in.txt"}, Dst: "*"},
+		{Cmd: []string{out, "yenc", "-d"}, Dst: src},
+		// decode fail
+		{Cmd: []string{in, "yenc", "-d"}, Dst: ""},
+		// no action
+		{Cmd: []string{in, "yenc"}, Dst: ""},
+	}
+
+	for _, tst := range tests {
+		exec(tst.Cmd...)
+		test.CheckResult(out, tst.Dst, t)
+	}
+
+	// CRC mismatch
+	exec(in, "yenc", "-e")
+	encoded, _ := os.ReadFile(out)
+	corrupted := regexp.MustCompile(`crc32=[0-9a-f]{8}`).ReplaceAll(encoded, []byte("crc32=00000000"))
+	os.WriteFile(out, corrupted, 0644)
+	exec(out, "yenc", "-d")
+	test.CheckResult(out, "", t)
+}
+
+func TestMime(t *testing.T) {
+	dir := t.TempDir()
+	var tests = []test.Test{
+		{Cmd: []string{in, "mime", "-e"}, Dst: "=?UTF-8?b?SGVsbG8g5LiW55WMIDEyMw==?="},
+		{Cmd: []string{out, "mime", "-d"}, Dst: src},
+		{Cmd: []string{in, "mime", "-e", "-q"}, Dst: "=?UTF-8?q?Hello_=E4=B8=96=E7=95=8C_123?="},
+		{Cmd: []string{out, "mime", "-d"}, Dst: src},
+		// extract parts
+		{Cmd: []string{"./testdata/in_mime.eml", "mime", "--extract", dir}, Dst: "part1.txt\ttext/plain\t8 bytes\nhello.txt\tapplication/octet-stream\t16 bytes"},
+		// not an email
+		{Cmd: []string{in, "mime", "--extract", dir}, Dst: ""},
+		// no action
+		{Cmd: []string{in, "mime"}, Dst: ""},
+	}
+
+	for _, tst := range tests {
+		exec(tst.Cmd...)
+		test.CheckResult(out, tst.Dst, t)
+	}
+
+	attachment, _ := os.ReadFile(filepath.Join(dir, "hello.txt"))
+	if string(attachment) != src {
+		t.Errorf("Expected %q, got %q", src, attachment)
+	}
+}
+
+func TestChr(t *testing.T) {
+	var (
+		gbk   = "./testdata/in_gbk.txt"
+		utf16 = "./testdata/in_utf16.txt"
+	)
+	var tests = []test.Test{
+		{Cmd: []string{in, "chr", "-t", "gbk"}, Dst: "Hello \xca\xc0\xbd\xe7 123"},
+		{Cmd: []string{out, "chr", "-f", "cp936"}, Dst: src},
+		{Cmd: []string{gbk, "chr", "--detect"}, Dst: "gb18030"},
+		{Cmd: []string{gbk, "chr", "-f", "auto"}, Dst: src},
+		{Cmd: []string{utf16, "chr", "--detect"}, Dst: "utf-16le"},
+		{Cmd: []string{utf16, "chr", "-f", "utf-16le"}, Dst: src},
+		{Cmd: []string{in, "chr", "--detect"}, Dst: "utf-8"},
+		// BOM overrides the byte order
+		{Cmd: []string{in, "chr", "-t", "utf-16be", "--bom"}, Dst: "\xfe\xff\x00H\x00e\x00l\x00l\x00o\x00 \x4e\x16\x75\x4c\x00 \x001\x002\x003"},
+		{Cmd: []string{out, "chr", "-f", "utf-16le"}, Dst: src},
+		{Cmd: []string{in, "chr", "-l"}, Dst: "*"},
+		// unsupported rune
+		{Cmd: []string{in, "chr", "-t", "latin1"}, Dst: ""},
+		// invalid charset
+		{Cmd: []string{in, "chr", "-t", "utf-7"}, Dst: ""},
+	}
+
+	for _, tst := range tests {
+		exec(tst.Cmd...)
+		test.CheckResult(out, tst.Dst, t)
+	}
+}
+
+func TestEsc(t *testing.T) {
+	var (
+		escIn  = "./testdata/in_esc.txt"
+		escSrc = "it's \"a\\b\"\n\t$x"
+	)
+	var tests = []test.Test{
+		{Cmd: []string{escIn, "esc", "-e", "-l", "c"}, Dst: "\"it's \\\"a\\\\b\\\"\\n\\t$x\""},
+		{Cmd: []string{out, "esc", "-d", "-l", "c"}, Dst: escSrc},
+		{Cmd: []string{escIn, "esc", "-e", "-l", "pybytes"}, Dst: "b'it\\'s \"a\\\\b\"\\n\\t$x'"},
+		{Cmd: []string{out, "esc", "-d", "-l", "pybytes"}, Dst: escSrc},
+		{Cmd: []string{escIn, "esc", "-e", "-l", "bash"}, Dst: "$'it\\'s \"a\\\\b\"\\n\\t$x'"},
+		{Cmd: []string{out, "esc", "-d", "-l", "bash"}, Dst: escSrc},
+		{Cmd: []string{escIn, "esc", "-e", "-l", "sh"}, Dst: "'it'\\''s \"a\\b\"\n\t$x'"},
+		{Cmd: []string{out, "esc", "-d", "-l", "sh"}, Dst: escSrc},
+		{Cmd: []string{escIn, "esc", "-e", "-l", "sql"}, Dst: "'it''s \"a\\b\"\n\t$x'"},
+		{Cmd: []string{out, "esc", "-d", "-l", "sql"}, Dst: escSrc},
+		{Cmd: []string{escIn, "esc", "-e", "-l", "regex"}, Dst: "it's \"a\\\\b\"\n\t\\$x"},
+		{Cmd: []string{out, "esc", "-d", "-l", "regex"}, Dst: escSrc},
+		{Cmd: []string{escIn, "esc", "-e", "-l", "csv"}, Dst: "\"it's \"\"a\\b\"\"\n\t$x\""},
+		{Cmd: []string{out, "esc", "-d", "-l", "csv"}, Dst: escSrc},
+		{Cmd: []string{escIn, "esc", "-e", "-l", "go"}, Dst: "\"it's \\\"a\\\\b\\\"\\n\\t$x\""},
+		{Cmd: []string{out, "esc", "-d", "-l", "go"}, Dst: escSrc},
+		{Cmd: []string{escIn, "esc", "-e", "-l", "python"}, Dst: "'it\\'s \"a\\\\b\"\\n\\t$x'"},
+		{Cmd: []string{out, "esc", "-d", "-l", "python"}, Dst: escSrc},
+		{Cmd: []string{escIn, "esc", "-e", "-l", "js"}, Dst: "\"it's \\\"a\\\\b\\\"\\n\\t$x\""},
+		{Cmd: []string{out, "esc", "-d", "-l", "js"}, Dst: escSrc},
+		{Cmd: []string{escIn, "esc", "-e", "-l", "java"}, Dst: "\"it's \\\"a\\\\b\\\"\\n\\t$x\""},
+		{Cmd: []string{out, "esc", "-d", "-l", "java"}, Dst: escSrc},
+		{Cmd: []string{escIn, "esc", "-e", "-l", "ps"}, Dst: "\"it's `\"a\\b`\"`n`t`$x\""},
+		{Cmd: []string{out, "esc", "-d", "-l", "ps"}, Dst: escSrc},
+		{Cmd: []string{escIn, "esc", "-e", "-l", "json"}, Dst: "\"it's \\\"a\\\\b\\\"\\n\\t$x\""},
+		{Cmd: []string{out, "esc", "-d", "-l", "json"}, Dst: escSrc},
+		// non-ASCII
+		{Cmd: []string{in, "esc", "-e", "-l", "c"}, Dst: "\"Hello \\xe4\\xb8\\x96\\xe7\\x95\\x8c 123\""},
+		{Cmd: []string{out, "esc", "-d", "-l", "c"}, Dst: src},
+		{Cmd: []string{in, "esc", "-e", "-l", "js"}, Dst: "\"Hello \\u4e16\\u754c 123\""},
+		{Cmd: []string{out, "esc", "-d", "-l", "js"}, Dst: src},
+		// \x and octal escapes are code points in python / js strings but bytes in c
+		{Cmd: []string{"./testdata/in_esc_x.txt", "esc", "-d", "-l", "python"}, Dst: "café é"},
+		{Cmd: []string{"./testdata/in_esc_x.txt", "esc", "-d", "-l", "js"}, Dst: "café é"},
+		{Cmd: []string{"./testdata/in_esc_x.txt", "esc", "-d", "-l", "pybytes"}, Dst: "caf\xe9 \xe9"},
+		// bytes literals and regexes have no \u escape
+		{Cmd: []string{"./testdata/in_esc_u.txt", "esc", "-d", "-l", "pybytes"}, Dst: "\\u00e9\xe9"},
+		{Cmd: []string{"./testdata/in_esc_u.txt", "esc", "-d", "-l", "regex"}, Dst: "b'\\u00e9é'"},
+		// hex escape followed by a hex digit
+		{Cmd: []string{"./testdata/in_utf16.txt", "esc", "-e", "-l", "c"}, Dst: "\"H\\x00\"\"e\\x00l\\x00l\\x00o\\x00 \\x00\\x16NLu \\x00\"\"1\\x00\"\"2\\x00\"\"3\\x00\""},
+		{Cmd: []string{out, "esc", "-d", "-l", "c"}, Dst: "H\x00e\x00l\x00l\x00o\x00 \x00\x16N\x4cu \x001\x002\x003\x00"},
+		// invalid UTF-8 in a Unicode string
+		{Cmd: []string{"./testdata/in_gbk.txt", "esc", "-e", "-l", "python"}, Dst: ""},
+		// byte arrays
+		{Cmd: []string{in, "esc", "-a", "c", "-w", "8"}, Dst: "unsigned char buf[] = {\n\t0x48, 0x65, 0x6c, 0x6c, 0x6f, 0x20, 0xe4, 0xb8,\n\t0x96, 0xe7, 0x95, 0x8c, 0x20, 0x31, 0x32, 0x33,\n};\nunsigned int buf_len = 16;"},
+		{Cmd: []string{in, "esc", "-a", "go", "-w", "0", "--delim", ","}, Dst: "buf := []byte{0x48,0x65,0x6c,0x6c,0x6f,0x20,0xe4,0xb8,0x96,0xe7,0x95,0x8c,0x20,0x31,0x32,0x33}"},
+		{Cmd: []string{in, "esc", "-a", "python"}, Dst: "buf = b\"\"\nbuf += b\"\\x48\\x65\\x6c\\x6c\\x6f\\x20\\xe4\\xb8\\x96\\xe7\\x95\\x8c\"\nbuf += b\"\\x20\\x31\\x32\\x33\""},
+		{Cmd: []string{in, "esc", "-a", "rust", "-n", "payload"}, Dst: "*"},
+		{Cmd: []string{in, "esc", "-a", "java"}, Dst: ""},
+		// invalid language
+		{Cmd: []string{in, "esc", "-e", "-l", "ruby"}, Dst: ""},
+		// no action
+		{Cmd: []string{in, "esc"}, Dst: ""},
+	}
+
+	for _, tst := range tests {
+		exec(tst.Cmd...)
+		test.CheckResult(out, tst.Dst, t)
+	}
+}
+
 func TestBsx62(t *testing.T) {
 	var tests = []test.Test{
 		// base 62
@@ -243,6 +535,8 @@ func TestDec(t *testing.T) {
 func TestURL(t *testing.T) {
 	in := "./testdata/in_url.txt"
 	in_fail := "./testdata/in_url_fail.txt"
+	parts := "./testdata/in_url_parts.txt"
+	idn := "./testdata/in_idn.txt"
 	src := "https://www.example.com/a/b/?c=d&e=f#g中文"
 
 	var tests = []test.Test{
@@ -252,8 +546,37 @@ func TestURL(t *testing.T) {
 		// all
 		{Cmd: []string{in, "url", "-ea"}, Dst: `https%3A%2F%2Fwww.example.com%2Fa%2Fb%2F%3Fc%3Dd%26e%3Df%23g%E4%B8%AD%E6%96%87`},
 		{Cmd: []string{out, "url", "-d"}, Dst: src},
+		// encoding modes
+		{Cmd: []string{in, "url", "-e", "-m", "path"}, Dst: "https:%2F%2Fwww.example.com%2Fa%2Fb%2F%3Fc=d&e=f%23g%E4%B8%AD%E6%96%87"},
+		{Cmd: []string{out, "url", "-d", "-m", "path"}, Dst: src},
+		{Cmd: []string{in, "url", "-e", "-m", "strict"}, Dst: "https%3A%2F%2Fwww.example.com%2Fa%2Fb%2F%3Fc%3Dd%26e%3Df%23g%E4%B8%AD%E6%96%87"},
+		{Cmd: []string{out, "url", "-d", "-m", "strict"}, Dst: src},
+		{Cmd: []string{in, "url", "-e", "-m", "full"}, Dst: "%68%74%74%70%73%3A%2F%2F%77%77%77%2E%65%78%61%6D%70%6C%65%2E%63%6F%6D%2F%61%2F%62%2F%3F%63%3D%64%26%65%3D%66%23%67%E4%B8%AD%E6%96%87"},
+		{Cmd: []string{out, "url", "-d"}, Dst: src},
+		// double encoding
+		{Cmd: []string{in, "url", "-e", "-m", "strict", "-n", "2"}, Dst: "https%253A%252F%252Fwww.example.com%252Fa%252Fb%252F%253Fc%253Dd%2526e%253Df%2523g%25E4%25B8%25AD%25E6%2596%2587"},
+		{Cmd: []string{out, "url", "-d"}, Dst: "https%3A%2F%2Fwww.example.com%2Fa%2Fb%2F%3Fc%3Dd%26e%3Df%23g%E4%B8%AD%E6%96%87"},
+		{Cmd: []string{in, "url", "-e", "-m", "strict", "-n", "3"}, Dst: "*"},
+		{Cmd: []string{out, "url", "-d", "-r"}, Dst: src},
+		{Cmd: []string{in, "url", "-ea", "-n", "2"}, Dst: "*"},
+		// invalid times
+		{Cmd: []string{in, "url", "-e", "-m", "strict", "-n", "0"}, Dst: ""},
+		// repeated encoding without a mode
+		{Cmd: []string{in, "url", "-e", "-n", "2"}, Dst: ""},
+		// parse
+		{Cmd: []string{parts, "url", "-p"}, Dst: "scheme\thttps\nusername\tuser\npassword\tp@ss\nhost\tbücher.xn--mnchen-3ya.de\nhost_unicode\tbücher.münchen.de\nport\t8443\npath\t/a b/c+d/中\nsegment[0]\ta b\nsegment[1]\tc+d\nsegment[2]\t中\nquery[q]\ta b\nquery[q]\t&x\nquery[empty]\t\nquery[bad]\t%zz\nfragment\tfrag x"},
+		{Cmd: []string{parts, "url", "-p", "-j"}, Dst: "{\n  \"scheme\": \"https\",\n  \"username\": \"user\",\n  \"password\": \"p@ss\",\n  \"host\": \"bücher.xn--mnchen-3ya.de\",\n  \"host_unicode\": \"bücher.münchen.de\",\n  \"port\": \"8443\",\n  \"path\": \"/a b/c+d/中\",\n  \"segments\": [\n    \"a b\",\n    \"c+d\",\n    \"中\"\n  ],\n  \"query\": [\n    {\n      \"key\": \"q\",\n      \"value\": \"a b\"\n    },\n    {\n      \"key\": \"q\",\n      \"value\": \"&x\"\n    },\n    {\n      \"key\": \"empty\",\n      \"value\": \"\"\n    },\n    {\n      \"key\": \"bad\",\n      \"value\": \"%zz\"\n    }\n  ],\n  \"fragment\": \"frag x\"\n}"},
+		// IDN
+		{Cmd: []string{idn, "url", "-e", "--idn"}, Dst: "https://xn--bcher-kva.xn--mnchen-3ya.de:80/ä?x=1"},
+		{Cmd: []string{out, "url", "-d", "--idn"}, Dst: "https://bücher.münchen.de:80/ä?x=1"},
+		// build query
+		{Cmd: []string{"./testdata/in_query.json", "url", "-b"}, Dst: "f%5Ba%5D=&f%5Bb%5D=true&n=12345678901234567890&q=a+b%26c&tag=x&tag=y"},
+		{Cmd: []string{in, "url", "-b"}, Dst: ""},
+		// invalid mode
+		{Cmd: []string{in, "url", "-e", "-m", "raw"}, Dst: ""},
 		// parse URL fail
 		{Cmd: []string{in_fail, "url", "-e"}, Dst: ""},
+		{Cmd: []string{in_fail, "url", "-p"}, Dst: ""},
 		// decode fail
 		{Cmd: []string{in_fail, "url", "-d"}, Dst: ""},
 		// no action
@@ -269,11 +592,40 @@ func TestURL(t *testing.T) {
 func TestHTML(t *testing.T) {
 	in := "./testdata/in_html.txt"
 	src := "<script>alert('xss');</script>"
+	double := "./testdata/in_html_double.txt"
 
 	var tests = []test.Test{
 		// normal
 		{Cmd: []string{in, "htm", "-e"}, Dst: `&lt;script&gt;alert(&#39;xss&#39;);&lt;/script&gt;`},
 		{Cmd: []string{out, "htm", "-d"}, Dst: src},
+		// reference forms and contexts
+		{Cmd: []string{in, "htm", "-e", "-f", "named"}, Dst: "&lt;script&gt;alert(&apos;xss&apos;);&lt;/script&gt;"},
+		{Cmd: []string{out, "htm", "-d"}, Dst: src},
+		{Cmd: []string{in, "htm", "-e", "-a", "-f", "named"}, Dst: "&lt;script&gt;alert&lpar;&apos;xss&apos;&rpar;&semi;&lt;&sol;script&gt;"},
+		{Cmd: []string{out, "htm", "-d"}, Dst: src},
+		{Cmd: []string{in, "htm", "-e", "-a", "-f", "dec"}, Dst: "&#60;script&#62;alert&#40;&#39;xss&#39;&#41;&#59;&#60;&#47;script&#62;"},
+		{Cmd: []string{out, "htm", "-d"}, Dst: src},
+		{Cmd: []string{in, "htm", "-e", "-c", "attr"}, Dst: "&#x3c;script&#x3e;alert&#x28;&#x27;xss&#x27;&#x29;&#x3b;&#x3c;&#x2f;script&#x3e;"},
+		{Cmd: []string{out, "htm", "-d", "-c", "attr"}, Dst: src},
+		{Cmd: []string{in, "htm", "-e", "-c", "js"}, Dst: "\\x3cscript\\x3ealert\\x28\\x27xss\\x27\\x29\\x3b\\x3c\\x2fscript\\x3e"},
+		{Cmd: []string{out, "htm", "-d", "-c", "js"}, Dst: src},
+		{Cmd: []string{in, "htm", "-e", "-c", "css"}, Dst: "\\3c script\\3e alert\\28 \\27 xss\\27 \\29 \\3b \\3c \\2f script\\3e "},
+		{Cmd: []string{out, "htm", "-d", "-c", "css"}, Dst: src},
+		{Cmd: []string{in, "htm", "-e", "-c", "url"}, Dst: "%3Cscript%3Ealert%28%27xss%27%29%3B%3C%2Fscript%3E"},
+		{Cmd: []string{out, "htm", "-d", "-c", "url"}, Dst: src},
+		// double encoding and missing semicolons
+		{Cmd: []string{double, "htm", "-d"}, Dst: "&amp;lt;script&gt<(1&rpar <x"},
+		{Cmd: []string{double, "htm", "-d", "-r"}, Dst: "<script><(1&rpar <x"},
+		{Cmd: []string{double, "htm", "-d", "-r", "-l"}, Dst: "<script><(1) <x"},
+		// any HTML5 name, taking the longest one
+		{Cmd: []string{"./testdata/in_html_lenient.txt", "htm", "-d", "-l"}, Dst: "♥ <script> ≂̸ <abc &zzz ∉"},
+		{Cmd: []string{"./testdata/in_html_lenient.txt", "htm", "-d"}, Dst: "&hearts <script> &NotEqualTilde <abc &zzz ¬in"},
+		// decode fail
+		{Cmd: []string{"./testdata/in_url_fail.txt", "htm", "-d", "-c", "url"}, Dst: ""},
+		// invalid context
+		{Cmd: []string{in, "htm", "-e", "-c", "sql"}, Dst: ""},
+		// invalid form
+		{Cmd: []string{in, "htm", "-e", "-f", "oct"}, Dst: ""},
 		// no action
 		{Cmd: []string{in, "htm"}, Dst: ""},
 	}
@@ -285,10 +637,45 @@ func TestHTML(t *testing.T) {
 }
 
 func TestUni(t *testing.T) {
+	emoji := "./testdata/in_emoji.txt"
 	var tests = []test.Test{
 		// normal
 		{Cmd: []string{in, "uni", "-e"}, Dst: `Hello \u4e16\u754c 123`},
 		{Cmd: []string{out, "uni", "-d"}, Dst: src},
+		// escape styles
+		{Cmd: []string{emoji, "uni", "-e", "-s", "json"}, Dst: `H\u00e9llo \ud83d\ude00`},
+		{Cmd: []string{out, "uni", "-d", "-s", "json"}, Dst: "Héllo 😀"},
+		{Cmd: []string{emoji, "uni", "-e", "-s", "python"}, Dst: `H\xe9llo \U0001f600`},
+		{Cmd: []string{out, "uni", "-d", "-s", "python"}, Dst: "Héllo 😀"},
+		{Cmd: []string{emoji, "uni", "-e"}, Dst: `H\u00e9llo \U0001f600`},
+		{Cmd: []string{out, "uni", "-d"}, Dst: "Héllo 😀"},
+		// a \U without 8 hex digits is kept as is
+		{Cmd: []string{"./testdata/in_uni_path.txt", "uni", "-d"}, Dst: `C:\Users世`},
+		// escape out of range
+		{Cmd: []string{"./testdata/in_uni_invalid.txt", "uni", "-d"}, Dst: ""},
+		{Cmd: []string{in, "uni", "-e", "-s", "perl"}, Dst: `Hello \x{4e16}\x{754c} 123`},
+		{Cmd: []string{out, "uni", "-d", "-s", "perl"}, Dst: src},
+		{Cmd: []string{emoji, "uni", "-e", "-s", "uplus"}, Dst: "U+0048 U+00E9 U+006C U+006C U+006F U+0020 U+1F600"},
+		{Cmd: []string{out, "uni", "-d", "-s", "uplus"}, Dst: "Héllo 😀"},
+		{Cmd: []string{in, "uni", "-e", "-s", "html"}, Dst: "Hello &#x4e16;&#x754c; 123"},
+		{Cmd: []string{out, "uni", "-d", "-s", "html"}, Dst: src},
+		{Cmd: []string{"./testdata/in_uni_html.txt", "uni", "-d", "-s", "html"}, Dst: "AAA 世"},
+		{Cmd: []string{in, "uni", "-e", "-s", "css"}, Dst: `Hello \004e16\00754c  123`},
+		{Cmd: []string{out, "uni", "-d", "-s", "css"}, Dst: src},
+		{Cmd: []string{in, "uni", "-e", "-s", "html", "-a"}, Dst: "&#x48;&#x65;&#x6c;&#x6c;&#x6f;&#x20;&#x4e16;&#x754c;&#x20;&#x31;&#x32;&#x33;"},
+		{Cmd: []string{out, "uni", "-d", "-s", "html"}, Dst: src},
+		// normalization
+		{Cmd: []string{emoji, "uni", "-n", "nfd"}, Dst: "He\u0301llo 😀"},
+		{Cmd: []string{out, "uni", "-n", "nfc"}, Dst: "Héllo 😀"},
+		// code point table
+		{Cmd: []string{emoji, "uni", "-t"}, Dst: "*"},
+		// suspicious characters
+		{Cmd: []string{"./testdata/in_homoglyph.txt", "uni", "-c"}, Dst: "1\tU+0430\tCYRILLIC SMALL LETTER A\tconfusable with \"a\"\n7\tU+200B\tZERO WIDTH SPACE\tinvisible\n15\tU+202E\tRIGHT-TO-LEFT OVERRIDE\tbidi control"},
+		{Cmd: []string{in, "uni", "-c"}, Dst: "No confusable or invisible characters found"},
+		// invalid style
+		{Cmd: []string{in, "uni", "-e", "-s", "ruby"}, Dst: ""},
+		// invalid normalization form
+		{Cmd: []string{in, "uni", "-n", "nfx"}, Dst: ""},
 		// no action
 		{Cmd: []string{in, "uni"}, Dst: ""},
 	}
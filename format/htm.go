@@ -16,27 +16,95 @@ limitations under the License.
 package format
 
 import (
+	"fmt"
 	"html"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
 
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
 
+var (
+	entityForm  string
+	htmContext  string
+	encodeAll   bool
+	recursive   bool
+	lenientHTML bool
+)
+
+// entityNames maps characters to their HTML5 named character references
+var entityNames = map[rune]string{
+	'\t': "Tab", '\n': "NewLine", '!': "excl", '"': "quot", '#': "num", '$': "dollar", '%': "percnt",
+	'&': "amp", '\'': "apos", '(': "lpar", ')': "rpar", '*': "ast", '+': "plus", ',': "comma",
+	'.': "period", '/': "sol", ':': "colon", ';': "semi", '<': "lt", '=': "equals", '>': "gt",
+	'?': "quest", '@': "commat", '[': "lsqb", '\\': "bsol", ']': "rsqb", '^': "Hat", '_': "lowbar",
+	'`': "grave", '{': "lcub", '|': "verbar", '}': "rcub",
+	0xa0: "nbsp", 0xa1: "iexcl", 0xa2: "cent", 0xa3: "pound", 0xa4: "curren", 0xa5: "yen", 0xa6: "brvbar",
+	0xa7: "sect", 0xa8: "uml", 0xa9: "copy", 0xaa: "ordf", 0xab: "laquo", 0xac: "not", 0xad: "shy",
+	0xae: "reg", 0xaf: "macr", 0xb0: "deg", 0xb1: "plusmn", 0xb2: "sup2", 0xb3: "sup3", 0xb4: "acute",
+	0xb5: "micro", 0xb6: "para", 0xb7: "middot", 0xb8: "cedil", 0xb9: "sup1", 0xba: "ordm", 0xbb: "raquo",
+	0xbc: "frac14", 0xbd: "frac12", 0xbe: "frac34", 0xbf: "iquest", 0xd7: "times", 0xf7: "divide",
+	0x2013: "ndash", 0x2014: "mdash", 0x2018: "lsquo", 0x2019: "rsquo", 0x201c: "ldquo", 0x201d: "rdquo",
+	0x2022: "bull", 0x2026: "hellip", 0x20ac: "euro", 0x2122: "trade",
+}
+
+var (
+	// unterminatedEntity matches a named reference that may lack its semicolon
+	unterminatedEntity = regexp.MustCompile(`&([A-Za-z][A-Za-z0-9]*)(;?)`)
+	// cssEscape matches a hex or single-character CSS escape
+	cssEscape = regexp.MustCompile(`\\([0-9a-fA-F]{1,6})[ \t\n\r\f]?|\\(.)`)
+)
+
 // NewHtmCmd represents the htm command
 func NewHtmCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "htm",
 		Short: "HTML Entity encode / decode",
 		Long: `HTML Entity encode / decode
+Contexts, encoding every non-alphanumeric character like the OWASP encoders:
+	html: HTML text, only & < > " ' unless --all (default)
+	attr: HTML attribute value
+	js: JavaScript string, \xHH and \uHHHH
+	css: CSS string or identifier, \HH followed by a space
+	url: URL component, %HH of each UTF-8 byte
 Example:
 	echo -n "hello" | att fmt -o out.txt htm -e
 	att fmt -i in.txt htm -d
+	att fmt -i in.txt htm -e --all -f named
+	att fmt -i in.txt htm -e -c js
+	att fmt -i in.txt htm -d -r --lenient
 `,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			switch entityForm {
+			case "", "named", "dec", "hex":
+			default:
+				return errors.New("recognize entity form " + entityForm)
+			}
+
 			if encode {
-				encoded := html.EscapeString(string(inputBytes))
+				encoded, err := encodeContext(string(inputBytes))
+				if err != nil {
+					return err
+				}
 				Echo(encoded)
 			} else if decode {
-				decoded := html.UnescapeString(string(inputBytes))
+				decoded, err := decodeContext(string(inputBytes))
+				// decode double encoding until nothing changes
+				for i := 0; recursive && err == nil && i < 8; i++ {
+					var again string
+					if again, err = decodeContext(decoded); again == decoded {
+						break
+					}
+					decoded = again
+				}
+				if err != nil {
+					return err
+				}
 				Echo(decoded)
 			} else {
 				NoActionSpecified()
@@ -47,10 +115,132 @@ Example:
 
 	cmd.Flags().BoolVarP(&encode, "encode", "e", false, "HTML Entity encode")
 	cmd.Flags().BoolVarP(&decode, "decode", "d", false, "HTML Entity decode")
+	cmd.Flags().StringVarP(&entityForm, "form", "f", "", "Character reference form: named / dec / hex")
+	cmd.Flags().StringVarP(&htmContext, "context", "c", "html", "Output context: html / attr / js / css / url")
+	cmd.Flags().BoolVarP(&encodeAll, "all", "a", false, "Encode all non-alphanumeric characters in the html context")
+	cmd.Flags().BoolVarP(&recursive, "recursive", "r", false, "Decode repeatedly until nothing changes")
+	cmd.Flags().BoolVarP(&lenientHTML, "lenient", "l", false, "Also decode named references missing their semicolon, e.g. &hearts or &ltscript")
 
 	return cmd
 }
 
+// isAlnum checks whether [r] is an ASCII letter or digit
+func isAlnum(r rune) bool {
+	return r >= '0' && r <= '9' || isASCIILetter(r)
+}
+
+// encodeContext encodes [s] for the chosen context
+func encodeContext(s string) (string, error) {
+	var b strings.Builder
+	switch htmContext {
+	case "html", "attr":
+		if htmContext == "html" && !encodeAll && entityForm == "" {
+			return html.EscapeString(s), nil
+		}
+		for _, r := range s {
+			if htmContext == "html" && !encodeAll && !strings.ContainsRune(`&<>"'`, r) || isAlnum(r) {
+				b.WriteRune(r)
+			} else {
+				b.WriteString(characterReference(r))
+			}
+		}
+	case "js":
+		for _, r := range s {
+			switch {
+			case isAlnum(r):
+				b.WriteRune(r)
+			case r < 0x100:
+				fmt.Fprintf(&b, `\x%02x`, r)
+			case r > 0xffff:
+				r1, r2 := utf16.EncodeRune(r)
+				fmt.Fprintf(&b, `\u%04x\u%04x`, r1, r2)
+			default:
+				fmt.Fprintf(&b, `\u%04x`, r)
+			}
+		}
+	case "css":
+		for _, r := range s {
+			if isAlnum(r) {
+				b.WriteRune(r)
+			} else {
+				fmt.Fprintf(&b, `\%x `, r)
+			}
+		}
+	case "url":
+		for _, c := range []byte(s) {
+			if isAlnum(rune(c)) {
+				b.WriteByte(c)
+			} else {
+				fmt.Fprintf(&b, "%%%02X", c)
+			}
+		}
+	default:
+		return "", errors.New("recognize context " + htmContext)
+	}
+	return b.String(), nil
+}
+
+// characterReference gets the reference to [r] in the chosen form, falling back to hex for unnamed characters
+func characterReference(r rune) string {
+	switch entityForm {
+	case "named":
+		if name, ok := entityNames[r]; ok {
+			return "&" + name + ";"
+		}
+	case "dec":
+		return "&#" + strconv.Itoa(int(r)) + ";"
+	}
+	return fmt.Sprintf("&#x%x;", r)
+}
+
+// decodeContext decodes [s] encoded for the chosen context
+func decodeContext(s string) (string, error) {
+	switch htmContext {
+	case "html", "attr":
+		if lenientHTML {
+			s = unterminatedEntity.ReplaceAllStringFunc(s, decodeUnterminated)
+		}
+		return html.UnescapeString(s), nil
+	case "js":
+		decoded, err := unescapeBackslash(s, "js")
+		return string(decoded), err
+	case "css":
+		return cssEscape.ReplaceAllStringFunc(s, func(escape string) string {
+			match := cssEscape.FindStringSubmatch(escape)
+			if match[2] != "" {
+				return match[2]
+			}
+			r, _ := strconv.ParseUint(match[1], 16, 32)
+			return string(rune(r))
+		}), nil
+	case "url":
+		decoded, err := url.PathUnescape(s)
+		if err != nil {
+			return "", errors.Wrap(err, "decode URL encoding")
+		}
+		return decoded, nil
+	}
+	return "", errors.New("recognize context " + htmContext)
+}
+
+// decodeUnterminated decodes the longest HTML5 named reference at the start of [ref] that lacks
+// its semicolon, looking names up in the full table of html.UnescapeString
+func decodeUnterminated(ref string) string {
+	match := unterminatedEntity.FindStringSubmatch(ref)
+	if match[2] != "" {
+		return ref
+	}
+	name := match[1]
+	for n := len(name); n > 0; n-- {
+		terminated := "&" + name[:n] + ";"
+		// characters of a reference are at most 2 runes, more means only a prefix was decoded
+		if decoded := html.UnescapeString(terminated); decoded != terminated && utf8.RuneCountInString(decoded) <= 2 {
+			return decoded + name[n:]
+		}
+	}
+	return ref
+}
+
 func init() {
 	fmtCmd.AddCommand(NewHtmCmd())
 }
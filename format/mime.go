@@ -0,0 +1,231 @@
+/*
+Copyright © 2021 SignorMercurio
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package format
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var (
+	qEncoding  bool
+	charset    string
+	extractDir string
+)
+
+// mimePart is a decoded leaf part of a MIME message
+type mimePart struct {
+	name      string
+	mediaType string
+	data      []byte
+}
+
+// mimeExtensions maps common media types to file extensions, independent of the system mime.types
+var mimeExtensions = map[string]string{
+	"text/plain": ".txt",
+	"text/html":  ".html",
+	"text/csv":   ".csv",
+}
+
+// NewMimeCmd represents the mime command
+func NewMimeCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "mime",
+		Short: "MIME encoded-word encode / decode, and .eml part extraction",
+		Long: `MIME encoded-word encode / decode, and .eml part extraction
+--extract decodes every part of an email (base64 / quoted-printable / uuencode) into the directory,
+naming it after its file name or its position.
+Example:
+	echo -n "héllo" | att fmt mime -e
+	echo -n "=?UTF-8?B?aMOpbGxv?=" | att fmt mime -d
+	att fmt -i mail.eml mime --extract parts`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if extractDir != "" {
+				listing, err := extractMIMEParts(inputBytes, extractDir)
+				if err != nil {
+					return err
+				}
+				Echo(listing)
+			} else if encode {
+				enc := mime.BEncoding
+				if qEncoding {
+					enc = mime.QEncoding
+				}
+				Echo(enc.Encode(charset, string(inputBytes)))
+			} else if decode {
+				decoded, err := new(mime.WordDecoder).DecodeHeader(string(inputBytes))
+				if err != nil {
+					return errors.Wrap(err, "decode MIME encoded-word")
+				}
+				Echo(decoded)
+			} else {
+				NoActionSpecified()
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVarP(&encode, "encode", "e", false, "Encode to a MIME encoded-word")
+	cmd.Flags().BoolVarP(&decode, "decode", "d", false, "Decode MIME encoded-words")
+	cmd.Flags().BoolVarP(&qEncoding, "q", "q", false, "Use Q encoding instead of B (base64) encoding")
+	cmd.Flags().StringVarP(&charset, "charset", "c", "UTF-8", "Charset of the encoded-word")
+	cmd.Flags().StringVar(&extractDir, "extract", "", "Extract all parts of an .eml to the directory")
+
+	return cmd
+}
+
+// extractMIMEParts writes every leaf part of the email [eml] into [dir], returning a listing
+func extractMIMEParts(eml []byte, dir string) (string, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(eml))
+	if err != nil {
+		return "", errors.Wrap(err, "parse email")
+	}
+
+	var parts []mimePart
+	if err := walkMIMEPart(mimeHeader(msg.Header), msg.Body, &parts); err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", errors.Wrap(err, "create output directory")
+	}
+
+	var lines []string
+	used := map[string]bool{}
+	for i, p := range parts {
+		name := p.name
+		if name == "" {
+			ext, ok := mimeExtensions[p.mediaType]
+			if !ok {
+				ext = ".bin"
+				if exts, _ := mime.ExtensionsByType(p.mediaType); len(exts) > 0 {
+					ext = exts[0]
+				}
+			}
+			name = fmt.Sprintf("part%d%s", i+1, ext)
+		}
+		if used[name] {
+			name = fmt.Sprintf("%d-%s", i+1, name)
+		}
+		used[name] = true
+
+		if err := os.WriteFile(filepath.Join(dir, name), p.data, 0644); err != nil {
+			return "", errors.Wrap(err, "write part")
+		}
+		lines = append(lines, fmt.Sprintf("%s\t%s\t%d bytes", name, p.mediaType, len(p.data)))
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// mimeHeader gets the headers of a part that matter for extraction
+func mimeHeader(h map[string][]string) map[string]string {
+	get := func(key string) string {
+		if values := h[key]; len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+	return map[string]string{
+		"type":        get("Content-Type"),
+		"disposition": get("Content-Disposition"),
+		"encoding":    strings.ToLower(strings.TrimSpace(get("Content-Transfer-Encoding"))),
+	}
+}
+
+// walkMIMEPart decodes the part [body] with headers [h], recursing into multipart and message parts
+func walkMIMEPart(h map[string]string, body io.Reader, parts *[]mimePart) error {
+	mediaType, params := "text/plain", map[string]string{}
+	if h["type"] != "" {
+		var err error
+		if mediaType, params, err = mime.ParseMediaType(h["type"]); err != nil {
+			return errors.Wrap(err, "parse content type")
+		}
+	}
+
+	switch {
+	case strings.HasPrefix(mediaType, "multipart/"):
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			p, err := mr.NextPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return errors.Wrap(err, "read multipart")
+			}
+			if err := walkMIMEPart(mimeHeader(p.Header), p, parts); err != nil {
+				return err
+			}
+		}
+	case mediaType == "message/rfc822":
+		msg, err := mail.ReadMessage(body)
+		if err != nil {
+			return errors.Wrap(err, "parse attached email")
+		}
+		return walkMIMEPart(mimeHeader(msg.Header), msg.Body, parts)
+	}
+
+	var data []byte
+	var err error
+	switch h["encoding"] {
+	case "base64":
+		data, err = ioutil.ReadAll(base64.NewDecoder(base64.StdEncoding, body))
+	case "quoted-printable":
+		data, err = ioutil.ReadAll(quotedprintable.NewReader(body))
+	case "x-uuencode", "uuencode":
+		if data, err = ioutil.ReadAll(body); err == nil {
+			data, err = uudecode(string(data))
+		}
+	default:
+		data, err = ioutil.ReadAll(body)
+	}
+	if err != nil {
+		return errors.Wrap(err, "decode part")
+	}
+
+	name := ""
+	if _, dispParams, err := mime.ParseMediaType(h["disposition"]); err == nil {
+		name = dispParams["filename"]
+	}
+	if name == "" {
+		name = params["name"]
+	}
+	if decoded, err := new(mime.WordDecoder).DecodeHeader(name); err == nil {
+		name = decoded
+	}
+	// never write outside the output directory
+	if name = filepath.Base(filepath.Clean("/" + name)); name == "/" || name == "." {
+		name = ""
+	}
+
+	*parts = append(*parts, mimePart{name: name, mediaType: mediaType, data: data})
+	return nil
+}
+
+func init() {
+	fmtCmd.AddCommand(NewMimeCmd())
+}
@@ -0,0 +1,67 @@
+/*
+Copyright © 2021 SignorMercurio
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package format
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime/quotedprintable"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var qpBinary bool
+
+// NewQpCmd represents the qp command
+func NewQpCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "qp",
+		Short: "Quoted-printable encode / decode",
+		Long: `Quoted-printable encode / decode
+Example:
+	echo -n "héllo" | att fmt -o out.txt qp -e
+	att fmt -i in.txt qp -d`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if encode {
+				var buf bytes.Buffer
+				w := quotedprintable.NewWriter(&buf)
+				w.Binary = qpBinary
+				w.Write(inputBytes)
+				w.Close()
+				Echo(buf.String())
+			} else if decode {
+				decoded, err := ioutil.ReadAll(quotedprintable.NewReader(bytes.NewReader(inputBytes)))
+				if err != nil {
+					return errors.Wrap(err, "decode quoted-printable")
+				}
+				Echo(string(decoded))
+			} else {
+				NoActionSpecified()
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVarP(&encode, "encode", "e", false, "Encode to quoted-printable")
+	cmd.Flags().BoolVarP(&decode, "decode", "d", false, "Decode from quoted-printable")
+	cmd.Flags().BoolVarP(&qpBinary, "binary", "b", false, "Encode line breaks as =0D=0A instead of CRLF")
+
+	return cmd
+}
+
+func init() {
+	fmtCmd.AddCommand(NewQpCmd())
+}
@@ -16,30 +16,110 @@ limitations under the License.
 package format
 
 import (
+	"fmt"
+	"regexp"
 	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf16"
 
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
+	"golang.org/x/text/unicode/norm"
+	"golang.org/x/text/unicode/runenames"
 )
 
+var (
+	uniStyle   string
+	escapeAll  bool
+	normForm   string
+	showTable  bool
+	checkChars bool
+)
+
+// uniPatterns match a single escape of each style when decoding, capturing its hex digits
+// in the first non-empty group. Decimal HTML references are captured in the last group
+var uniPatterns = map[string]*regexp.Regexp{
+	"json":   regexp.MustCompile(`\\u([0-9a-fA-F]{4})(\\u[0-9a-fA-F]{4})?`),
+	"python": regexp.MustCompile(`\\U([0-9a-fA-F]{8})|\\u([0-9a-fA-F]{4})|\\x([0-9a-fA-F]{2})`),
+	"perl":   regexp.MustCompile(`\\x\{([0-9a-fA-F]{1,6})\}`),
+	"uplus":  regexp.MustCompile(`[Uu]\+([0-9a-fA-F]{4,6}) ?`),
+	"html":   regexp.MustCompile(`&#(?:[xX]([0-9a-fA-F]{1,6})|([0-9]{1,7}));`),
+	"css":    regexp.MustCompile(`\\([0-9a-fA-F]{1,6}) ?`),
+}
+
+// normForms maps normalization form names to their forms
+var normForms = map[string]norm.Form{
+	"nfc":  norm.NFC,
+	"nfd":  norm.NFD,
+	"nfkc": norm.NFKC,
+	"nfkd": norm.NFKD,
+}
+
+// homoglyphs maps non-Latin letters to the ASCII letters they are easily mistaken for
+var homoglyphs = map[rune]rune{
+	// Cyrillic
+	'а': 'a', 'е': 'e', 'о': 'o', 'р': 'p', 'с': 'c', 'у': 'y', 'х': 'x', 'ѕ': 's', 'і': 'i', 'ј': 'j',
+	'ԁ': 'd', 'һ': 'h', 'ԛ': 'q', 'ԝ': 'w', 'ӏ': 'l',
+	'А': 'A', 'В': 'B', 'Е': 'E', 'К': 'K', 'М': 'M', 'Н': 'H', 'О': 'O', 'Р': 'P', 'С': 'C', 'Т': 'T',
+	'Х': 'X', 'У': 'Y', 'Ѕ': 'S', 'І': 'I', 'Ј': 'J',
+	// Greek
+	'α': 'a', 'ο': 'o', 'ν': 'v', 'ρ': 'p', 'ι': 'i',
+	'Α': 'A', 'Β': 'B', 'Ε': 'E', 'Ζ': 'Z', 'Η': 'H', 'Ι': 'I', 'Κ': 'K', 'Μ': 'M', 'Ν': 'N', 'Ο': 'O',
+	'Ρ': 'P', 'Τ': 'T', 'Υ': 'Y', 'Χ': 'X',
+	// Armenian and Latin extensions
+	'օ': 'o', 'ս': 'u', 'ı': 'i',
+}
+
 // NewUniCmd represents the uni command
 func NewUniCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "uni",
 		Short: "Unicode conversion",
 		Long: `Unicode conversion
+Escape styles:
+	go: \u4e16, \U0001f600 (default)
+	json: \u4e16, \ud83d\ude00 (JSON / JavaScript surrogate pairs)
+	python: \xe9, \u4e16, \U0001f600
+	perl: \x{4e16}
+	uplus: U+4E16, separated by spaces
+	html: &#x4e16;
+	css: \004e16
 Example:
 	echo -n "hello" | att fmt -o out.txt uni -e
 	att fmt -i in.txt uni -d
+	att fmt -i in.txt uni -e -s json
+	att fmt -i in.txt uni -n nfkc
+	att fmt -i in.txt uni --table
+	att fmt -i in.txt uni --check
 `,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			if encode {
-				quoted := strconv.QuoteToASCII(string(inputBytes))
-				encoded := quoted[1 : len(quoted)-1] // strip ""
-				Echo(encoded)
+			if _, ok := uniPatterns[uniStyle]; !ok && uniStyle != "go" {
+				return errors.New("recognize escape style " + uniStyle)
+			}
+
+			if showTable {
+				Echo(codePointTable(string(inputBytes)))
+			} else if checkChars {
+				Echo(checkSuspicious(string(inputBytes)))
+			} else if normForm != "" {
+				form, ok := normForms[strings.ToLower(normForm)]
+				if !ok {
+					return errors.New("recognize normalization form " + normForm)
+				}
+				Echo(form.String(string(inputBytes)))
+			} else if encode {
+				Echo(toUnicode(string(inputBytes)))
 			} else if decode {
-				decoded := fromUnicode(string(inputBytes))
-				Echo(decoded)
+				if uniStyle == "go" {
+					decoded, err := fromUnicode(string(inputBytes))
+					if err != nil {
+						return err
+					}
+					Echo(decoded)
+				} else {
+					Echo(unescapeUnicode(string(inputBytes)))
+				}
 			} else {
 				NoActionSpecified()
 			}
@@ -49,18 +129,174 @@ Example:
 
 	cmd.Flags().BoolVarP(&encode, "encode", "e", false, "convert to unicode")
 	cmd.Flags().BoolVarP(&decode, "decode", "d", false, "convert from unicode")
+	cmd.Flags().StringVarP(&uniStyle, "style", "s", "go", "Escape style: go / json / python / perl / uplus / html / css")
+	cmd.Flags().BoolVarP(&escapeAll, "all", "a", false, "Escape ASCII characters too")
+	cmd.Flags().StringVarP(&normForm, "norm", "n", "", "Apply normalization: nfc / nfd / nfkc / nfkd")
+	cmd.Flags().BoolVarP(&showTable, "table", "t", false, "Show the code points with their names")
+	cmd.Flags().BoolVarP(&checkChars, "check", "c", false, "Flag confusable and invisible characters")
 
 	return cmd
 }
 
-func fromUnicode(from string) string {
-	str, _ := strconv.Unquote(strings.Replace(
-		strconv.Quote(from),
-		`\\u`,
-		`\u`,
-		-1,
-	)) // no error as long as calling strconv.Quote beforehand
-	return str
+// goEscape matches a quoted \u or \U escape with its full count of hex digits
+var goEscape = regexp.MustCompile(`\\\\(u[0-9a-fA-F]{4}|U[0-9a-fA-F]{8})`)
+
+func fromUnicode(from string) (string, error) {
+	str, err := strconv.Unquote(goEscape.ReplaceAllString(strconv.Quote(from), `\$1`))
+	if err != nil {
+		return "", errors.Wrap(err, "unescape Unicode")
+	}
+	return str, nil
+}
+
+// toUnicode escapes the non-ASCII characters of [from], or all characters with --all, in the chosen style
+func toUnicode(from string) string {
+	if uniStyle == "go" && !escapeAll {
+		quoted := strconv.QuoteToASCII(from)
+		return quoted[1 : len(quoted)-1] // strip ""
+	}
+
+	var escaped []string
+	runes := []rune(from)
+	for i, r := range runes {
+		if uniStyle != "uplus" && r < 0x80 && !escapeAll {
+			escaped = append(escaped, string(r))
+			continue
+		}
+		escape := escapeRune(r)
+		// a whitespace right after a CSS escape is taken as its terminator
+		if uniStyle == "css" && !escapeAll && i+1 < len(runes) && unicode.IsSpace(runes[i+1]) {
+			escape += " "
+		}
+		escaped = append(escaped, escape)
+	}
+	if uniStyle == "uplus" {
+		return strings.Join(escaped, " ")
+	}
+	return strings.Join(escaped, "")
+}
+
+// escapeRune escapes [r] in the chosen style
+func escapeRune(r rune) string {
+	switch uniStyle {
+	case "json":
+		if r > 0xffff {
+			r1, r2 := utf16.EncodeRune(r)
+			return fmt.Sprintf(`\u%04x\u%04x`, r1, r2)
+		}
+		return fmt.Sprintf(`\u%04x`, r)
+	case "python":
+		if r < 0x100 {
+			return fmt.Sprintf(`\x%02x`, r)
+		}
+		fallthrough
+	case "go":
+		if r > 0xffff {
+			return fmt.Sprintf(`\U%08x`, r)
+		}
+		return fmt.Sprintf(`\u%04x`, r)
+	case "perl":
+		return fmt.Sprintf(`\x{%x}`, r)
+	case "uplus":
+		return fmt.Sprintf("U+%04X", r)
+	case "html":
+		return fmt.Sprintf("&#x%x;", r)
+	default: // css
+		return fmt.Sprintf(`\%06x`, r)
+	}
+}
+
+// unescapeUnicode replaces escapes of the chosen style in [from] with the characters
+func unescapeUnicode(from string) string {
+	pattern := uniPatterns[uniStyle]
+	return pattern.ReplaceAllStringFunc(from, func(escape string) string {
+		if uniStyle == "json" && len(escape) == 12 {
+			r1, _ := strconv.ParseUint(escape[2:6], 16, 32)
+			r2, _ := strconv.ParseUint(escape[8:12], 16, 32)
+			if r := utf16.DecodeRune(rune(r1), rune(r2)); r != unicode.ReplacementChar {
+				return string(r)
+			}
+			return unescapeUnicode(escape[:6]) + unescapeUnicode(escape[6:])
+		}
+
+		var digits string
+		base := 16
+		groups := pattern.FindStringSubmatch(escape)
+		for i := 1; i < len(groups); i++ {
+			if groups[i] != "" {
+				digits = groups[i]
+				if uniStyle == "html" && i == 2 {
+					base = 10
+				}
+				break
+			}
+		}
+		r, err := strconv.ParseUint(digits, base, 32)
+		if err != nil || r > unicode.MaxRune {
+			return escape
+		}
+		return string(rune(r))
+	})
+}
+
+// runeName gets the Unicode name of [r]
+func runeName(r rune) string {
+	if name := runenames.Name(r); name != "" {
+		return name
+	}
+	return "<unnamed>"
+}
+
+// codePointTable lists each character of [from] with its code point, UTF-8 bytes and name
+func codePointTable(from string) string {
+	var lines []string
+	for _, r := range from {
+		char := string(r)
+		if !unicode.IsPrint(r) {
+			char = " "
+		}
+		lines = append(lines, fmt.Sprintf("U+%04X\t%s\t% x\t%s", r, char, []byte(string(r)), runeName(r)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// checkSuspicious flags invisible, bidi control and confusable characters in [from] with their byte offsets
+func checkSuspicious(from string) string {
+	var lines []string
+	for i, r := range from {
+		var reason string
+		switch {
+		case r >= 0x202a && r <= 0x202e, r >= 0x2066 && r <= 0x2069, r == 0x200e, r == 0x200f, r == 0x061c:
+			reason = "bidi control"
+		case unicode.Is(unicode.Cf, r), unicode.Is(unicode.Variation_Selector, r), r == 0x115f, r == 0x1160, r == 0x3164, r == 0xffa0:
+			reason = "invisible"
+		case unicode.IsSpace(r) && r >= 0x80:
+			reason = "unusual whitespace"
+		default:
+			if ascii, ok := homoglyphs[r]; ok {
+				reason = fmt.Sprintf("confusable with %q", string(ascii))
+			} else if folded := norm.NFKC.String(string(r)); r >= 0x80 && folded != string(r) && isASCIIString(folded) {
+				reason = fmt.Sprintf("confusable with %q", folded)
+			}
+		}
+		if reason != "" {
+			lines = append(lines, fmt.Sprintf("%d\tU+%04X\t%s\t%s", i, r, runeName(r), reason))
+		}
+	}
+	if len(lines) == 0 {
+		return "No confusable or invisible characters found"
+	}
+	return strings.Join(lines, "\n")
+}
+
+// isASCIIString checks whether [s] only consists of printable ASCII characters
+func isASCIIString(s string) bool {
+	for _, r := range s {
+		if r < 0x20 || r > 0x7e {
+			return false
+		}
+	}
+	return true
 }
 
 func init() {
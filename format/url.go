@@ -16,43 +16,122 @@ limitations under the License.
 package format
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
 	"net/url"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
+	"golang.org/x/net/idna"
 )
 
 var (
-	all bool
+	all        bool
+	urlMode    string
+	times      int
+	parseURL   bool
+	asJSON     bool
+	recursiveD bool
+	idn        bool
+	buildQuery bool
 )
 
+// urlParts are the components of a parsed URL
+type urlParts struct {
+	Scheme      string       `json:"scheme"`
+	Username    string       `json:"username,omitempty"`
+	Password    string       `json:"password,omitempty"`
+	Host        string       `json:"host"`
+	HostUnicode string       `json:"host_unicode,omitempty"`
+	Port        string       `json:"port,omitempty"`
+	Path        string       `json:"path"`
+	Segments    []string     `json:"segments"`
+	Query       []queryParam `json:"query"`
+	Fragment    string       `json:"fragment,omitempty"`
+}
+
+// queryParam is a decoded query parameter, kept in order and with repeated keys
+type queryParam struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
 // NewUrlCmd represents the url command
 func NewUrlCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "url",
 		Short: "URL encode / decode",
 		Long: `URL encode / decode
+Encoding modes:
+	form: application/x-www-form-urlencoded, space as + (same as --all)
+	path: path segment
+	strict: RFC 3986, everything but unreserved characters
+	full: every byte, unreserved characters included
 Example:
 	echo -n "hello" | att fmt -o out.txt url -ea
 	att fmt -i in.txt url -d
+	att fmt -i in.txt url -e -m full -n 2
+	att fmt -i in.txt url -d -r
+	att fmt -i in.txt url -p --json
+	echo -n "https://bücher.example/" | att fmt url -e --idn
+	echo -n '{"q":"a b","tag":["x","y"]}' | att fmt url -b
 `,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			if encode {
-				var encoded string
+			input := string(inputBytes)
+			if parseURL {
+				parsed, err := parseURLParts(input)
+				if err != nil {
+					return err
+				}
+				Echo(parsed)
+			} else if buildQuery {
+				query, err := buildQueryString(inputBytes)
+				if err != nil {
+					return err
+				}
+				Echo(query)
+			} else if idn && (encode || decode) {
+				converted, err := convertIDN(input, encode)
+				if err != nil {
+					return err
+				}
+				Echo(converted)
+			} else if encode {
+				mode := urlMode
 				if all {
-					encoded = url.QueryEscape(string(inputBytes))
-				} else {
-					resURL, err := url.Parse(string(inputBytes))
-					if err != nil {
-						return errors.Wrap(err, "parse URL")
+					mode = "form"
+				}
+				if times < 1 {
+					return errors.New("validate times: it must be at least 1")
+				}
+				// the default mode keeps valid escapes, so encoding again changes nothing
+				if times > 1 && mode == "" {
+					return errors.New("encode repeatedly in the default mode. Please specify -m")
+				}
+				encoded := input
+				for i := 0; i < times; i++ {
+					var err error
+					if encoded, err = encodeURL(encoded, mode); err != nil {
+						return err
 					}
-					encoded = resURL.String()
 				}
 				Echo(encoded)
 			} else if decode {
-				decoded, err := url.QueryUnescape(string(inputBytes))
+				decoded, err := decodeURL(input)
+				// decode double encoding until nothing changes
+				for i := 0; recursiveD && err == nil && i < 8; i++ {
+					var again string
+					if again, err = decodeURL(decoded); again == decoded {
+						break
+					}
+					decoded = again
+				}
 				if err != nil {
-					return errors.Wrap(err, "decode URL")
+					return err
 				}
 				Echo(decoded)
 			} else {
@@ -65,10 +144,212 @@ Example:
 	cmd.Flags().BoolVarP(&encode, "encode", "e", false, "URL encode")
 	cmd.Flags().BoolVarP(&decode, "decode", "d", false, "URL decode")
 	cmd.Flags().BoolVarP(&all, "all", "a", false, "URL encode all special characters")
+	cmd.Flags().StringVarP(&urlMode, "mode", "m", "", "Encoding mode: form / path / strict / full")
+	cmd.Flags().IntVarP(&times, "times", "n", 1, "Number of times to encode, more than once needs -m or -a")
+	cmd.Flags().BoolVarP(&recursiveD, "recursive", "r", false, "Decode repeatedly until nothing changes")
+	cmd.Flags().BoolVarP(&parseURL, "parse", "p", false, "Parse the URL into its components")
+	cmd.Flags().BoolVarP(&asJSON, "json", "j", false, "Print the parsed components as JSON")
+	cmd.Flags().BoolVar(&idn, "idn", false, "Convert the host between Unicode and punycode")
+	cmd.Flags().BoolVarP(&buildQuery, "build", "b", false, "Build a query string from a JSON object")
 
 	return cmd
 }
 
+// encodeURL encodes [s] once in [mode]
+func encodeURL(s string, mode string) (string, error) {
+	switch mode {
+	case "":
+		resURL, err := url.Parse(s)
+		if err != nil {
+			return "", errors.Wrap(err, "parse URL")
+		}
+		return resURL.String(), nil
+	case "form":
+		return url.QueryEscape(s), nil
+	case "path":
+		return url.PathEscape(s), nil
+	case "strict", "full":
+		var b strings.Builder
+		for _, c := range []byte(s) {
+			if mode == "strict" && (isAlnum(rune(c)) || strings.IndexByte("-._~", c) >= 0) {
+				b.WriteByte(c)
+			} else {
+				fmt.Fprintf(&b, "%%%02X", c)
+			}
+		}
+		return b.String(), nil
+	}
+	return "", errors.New("recognize encoding mode " + mode)
+}
+
+// decodeURL decodes [s] once, treating + as space unless in path mode
+func decodeURL(s string) (string, error) {
+	var decoded string
+	var err error
+	if urlMode == "" || urlMode == "form" {
+		decoded, err = url.QueryUnescape(s)
+	} else {
+		decoded, err = url.PathUnescape(s)
+	}
+	if err != nil {
+		return "", errors.Wrap(err, "decode URL")
+	}
+	return decoded, nil
+}
+
+// unescapeOrRaw decodes a query component, keeping it as is if malformed
+func unescapeOrRaw(s string) string {
+	if decoded, err := url.QueryUnescape(s); err == nil {
+		return decoded
+	}
+	return s
+}
+
+// parseURLParts parses [rawURL] and formats its components as a table or JSON
+func parseURLParts(rawURL string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return "", errors.Wrap(err, "parse URL")
+	}
+
+	parts := urlParts{
+		Scheme:   u.Scheme,
+		Username: u.User.Username(),
+		Host:     u.Hostname(),
+		Port:     u.Port(),
+		Path:     u.Path,
+		Segments: []string{},
+		Query:    []queryParam{},
+		Fragment: u.Fragment,
+	}
+	parts.Password, _ = u.User.Password()
+	if unicodeHost, err := idna.ToUnicode(parts.Host); err == nil && unicodeHost != parts.Host {
+		parts.HostUnicode = unicodeHost
+	}
+	for _, segment := range strings.Split(strings.Trim(u.EscapedPath(), "/"), "/") {
+		if segment != "" {
+			parts.Segments = append(parts.Segments, unescapeOrRaw(strings.ReplaceAll(segment, "+", "%2B")))
+		}
+	}
+	for _, pair := range strings.Split(u.RawQuery, "&") {
+		if pair == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		param := queryParam{Key: unescapeOrRaw(kv[0])}
+		if len(kv) == 2 {
+			param.Value = unescapeOrRaw(kv[1])
+		}
+		parts.Query = append(parts.Query, param)
+	}
+
+	if asJSON {
+		// keep & and = of query values readable
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		enc.Encode(parts)
+		return strings.TrimSuffix(buf.String(), "\n"), nil
+	}
+
+	rows := [][2]string{
+		{"scheme", parts.Scheme},
+		{"username", parts.Username},
+		{"password", parts.Password},
+		{"host", parts.Host},
+		{"host_unicode", parts.HostUnicode},
+		{"port", parts.Port},
+		{"path", parts.Path},
+	}
+	var lines []string
+	for _, row := range rows {
+		if row[1] != "" {
+			lines = append(lines, row[0]+"\t"+row[1])
+		}
+	}
+	for i, segment := range parts.Segments {
+		lines = append(lines, "segment["+strconv.Itoa(i)+"]\t"+segment)
+	}
+	for _, param := range parts.Query {
+		lines = append(lines, "query["+param.Key+"]\t"+param.Value)
+	}
+	if parts.Fragment != "" {
+		lines = append(lines, "fragment\t"+parts.Fragment)
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// convertIDN converts the host of the URL or domain [s] to punycode if [toASCII], or to Unicode otherwise
+func convertIDN(s string, toASCII bool) (string, error) {
+	convert := idna.ToUnicode
+	if toASCII {
+		convert = idna.Lookup.ToASCII
+	}
+
+	u, err := url.Parse(s)
+	if err != nil || u.Host == "" {
+		converted, err := convert(s)
+		if err != nil {
+			return "", errors.Wrap(err, "convert domain")
+		}
+		return converted, nil
+	}
+
+	host, err := convert(u.Hostname())
+	if err != nil {
+		return "", errors.Wrap(err, "convert host")
+	}
+	if u.Port() != "" {
+		host += ":" + u.Port()
+	}
+	// replace in place, since re-encoding the URL would escape a Unicode host
+	prefix := "//"
+	if u.User != nil {
+		prefix = "@"
+	}
+	return strings.Replace(s, prefix+u.Host, prefix+host, 1), nil
+}
+
+// buildQueryString builds a sorted query string from the JSON object [src], repeating keys of arrays
+// and using key[sub] for nested objects
+func buildQueryString(src []byte) (string, error) {
+	var object map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(src))
+	decoder.UseNumber()
+	if err := decoder.Decode(&object); err != nil {
+		return "", errors.Wrap(err, "parse JSON object")
+	}
+
+	values := url.Values{}
+	var add func(key string, value interface{})
+	add = func(key string, value interface{}) {
+		switch v := value.(type) {
+		case []interface{}:
+			for _, item := range v {
+				add(key, item)
+			}
+		case map[string]interface{}:
+			subKeys := make([]string, 0, len(v))
+			for subKey := range v {
+				subKeys = append(subKeys, subKey)
+			}
+			sort.Strings(subKeys)
+			for _, subKey := range subKeys {
+				add(key+"["+subKey+"]", v[subKey])
+			}
+		case nil:
+			values.Add(key, "")
+		default:
+			values.Add(key, fmt.Sprint(v))
+		}
+	}
+	for key, value := range object {
+		add(key, value)
+	}
+	return values.Encode(), nil
+}
+
 func init() {
 	fmtCmd.AddCommand(NewUrlCmd())
 }
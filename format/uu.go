@@ -0,0 +1,178 @@
+/*
+Copyright © 2021 SignorMercurio
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package format
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+const (
+	uuLineBytes = 45
+	xxAlphabet  = "+-0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+)
+
+var (
+	uuName string
+	uuMode string
+	useXX  bool
+)
+
+// NewUuCmd represents the uu command
+func NewUuCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "uu",
+		Short: "uuencode / xxencode encode / decode",
+		Long: `uuencode / xxencode encode / decode
+Encoded data is framed by "begin <mode> <name>" and "end" lines.
+When decoding, the mode and name in the header are ignored.
+Example:
+	att fmt -i payload.bin -o out.txt uu -e --name payload.bin
+	att fmt -i in.txt uu -d
+	att fmt -i in.txt uu -d --xx`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if encode {
+				Echo(uuencode(inputBytes))
+			} else if decode {
+				decoded, err := uudecode(string(inputBytes))
+				if err != nil {
+					return err
+				}
+				Echo(string(decoded))
+			} else {
+				NoActionSpecified()
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVarP(&encode, "encode", "e", false, "uuencode")
+	cmd.Flags().BoolVarP(&decode, "decode", "d", false, "uudecode")
+	cmd.Flags().StringVarP(&uuName, "name", "n", "data", "File name in the begin line")
+	cmd.Flags().StringVarP(&uuMode, "mode", "m", "644", "File mode in the begin line")
+	cmd.Flags().BoolVarP(&useXX, "xx", "x", false, "Use xxencode alphabet")
+
+	return cmd
+}
+
+// uuChar encodes a 6-bit value
+func uuChar(v byte) byte {
+	if useXX {
+		return xxAlphabet[v&63]
+	}
+	if v&63 == 0 {
+		return '`'
+	}
+	return v&63 + ' '
+}
+
+// uuValue decodes a character to its 6-bit value
+func uuValue(c byte) (byte, error) {
+	if useXX {
+		v := strings.IndexByte(xxAlphabet, c)
+		if v < 0 {
+			return 0, errors.New("recognize character " + string(c))
+		}
+		return byte(v), nil
+	}
+	if c < ' ' || c > '`' {
+		return 0, errors.New("recognize character " + string(c))
+	}
+	return (c - ' ') & 63, nil
+}
+
+// uuencode encodes [src] in lines of 45 bytes
+func uuencode(src []byte) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "begin %s %s\n", uuMode, uuName)
+	for i := 0; i < len(src); i += uuLineBytes {
+		line := src[i:]
+		if len(line) > uuLineBytes {
+			line = line[:uuLineBytes]
+		}
+
+		b.WriteByte(uuChar(byte(len(line))))
+		for j := 0; j < len(line); j += 3 {
+			var group [3]byte
+			copy(group[:], line[j:])
+			b.WriteByte(uuChar(group[0] >> 2))
+			b.WriteByte(uuChar(group[0]<<4 | group[1]>>4))
+			b.WriteByte(uuChar(group[1]<<2 | group[2]>>6))
+			b.WriteByte(uuChar(group[2]))
+		}
+		b.WriteByte('\n')
+	}
+	b.WriteByte(uuChar(0))
+	b.WriteString("\nend\n")
+	return b.String()
+}
+
+// uudecode decodes the lines between the begin and end lines
+func uudecode(encoded string) ([]byte, error) {
+	lines := strings.Split(strings.ReplaceAll(encoded, "\r\n", "\n"), "\n")
+	start := -1
+	for i, line := range lines {
+		if strings.HasPrefix(line, "begin ") {
+			start = i + 1
+			break
+		}
+	}
+	if start < 0 {
+		return nil, errors.New("find begin line")
+	}
+
+	var decoded []byte
+	for _, line := range lines[start:] {
+		if line == "end" {
+			return decoded, nil
+		}
+		if line == "" {
+			continue
+		}
+
+		n, err := uuValue(line[0])
+		if err != nil {
+			return nil, errors.Wrap(err, "decode line length")
+		}
+		if n == 0 {
+			continue
+		}
+		chars := line[1:]
+		// trailing spaces may be stripped in transit
+		if need := (int(n) + 2) / 3 * 4; len(chars) < need {
+			chars += strings.Repeat(string(uuChar(0)), need-len(chars))
+		}
+
+		var lineBytes []byte
+		for j := 0; len(lineBytes) < int(n); j += 4 {
+			var v [4]byte
+			for k := 0; k < 4; k++ {
+				if v[k], err = uuValue(chars[j+k]); err != nil {
+					return nil, err
+				}
+			}
+			lineBytes = append(lineBytes, v[0]<<2|v[1]>>4, v[1]<<4|v[2]>>2, v[2]<<6|v[3])
+		}
+		decoded = append(decoded, lineBytes[:n]...)
+	}
+	return nil, errors.New("find end line")
+}
+
+func init() {
+	fmtCmd.AddCommand(NewUuCmd())
+}
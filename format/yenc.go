@@ -0,0 +1,175 @@
+/*
+Copyright © 2021 SignorMercurio
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package format
+
+import (
+	"fmt"
+	"hash/crc32"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var (
+	yencName    string
+	yencLineLen int
+)
+
+// NewYencCmd represents the yenc command
+func NewYencCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "yenc",
+		Short: "yEnc encode / decode",
+		Long: `yEnc encode / decode
+Encoded data is framed by =ybegin and =yend lines. The size and CRC32 in the =yend line are verified when decoding.
+Example:
+	att fmt -i payload.bin -o out.txt yenc -e --name payload.bin
+	att fmt -i in.txt yenc -d`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if encode {
+				Echo(yencEncode(inputBytes))
+			} else if decode {
+				decoded, err := yencDecode(string(inputBytes))
+				if err != nil {
+					return err
+				}
+				Echo(string(decoded))
+			} else {
+				NoActionSpecified()
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVarP(&encode, "encode", "e", false, "Encode to yEnc")
+	cmd.Flags().BoolVarP(&decode, "decode", "d", false, "Decode from yEnc")
+	cmd.Flags().StringVarP(&yencName, "name", "n", "data", "File name in the =ybegin line")
+	cmd.Flags().IntVarP(&yencLineLen, "line", "l", 128, "Line length of encoded data")
+
+	return cmd
+}
+
+// yencEncode encodes [src] in lines of the line length, escaping critical characters
+func yencEncode(src []byte) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "=ybegin line=%d size=%d name=%s\n", yencLineLen, len(src), yencName)
+
+	col := 0
+	for i, c := range src {
+		o := c + 42
+		escape := o == 0 || o == '\n' || o == '\r' || o == '='
+		// leading / trailing whitespace and leading dots may be mangled in transit
+		if (o == '\t' || o == ' ') && (col == 0 || col >= yencLineLen-1 || i == len(src)-1) {
+			escape = true
+		}
+		if o == '.' && col == 0 {
+			escape = true
+		}
+
+		if escape {
+			b.WriteByte('=')
+			o += 64
+			col++
+		}
+		b.WriteByte(o)
+		col++
+		if col >= yencLineLen {
+			b.WriteByte('\n')
+			col = 0
+		}
+	}
+	if col > 0 {
+		b.WriteByte('\n')
+	}
+
+	fmt.Fprintf(&b, "=yend size=%d crc32=%08x\n", len(src), crc32.ChecksumIEEE(src))
+	return b.String()
+}
+
+// yencParams parses the key=value parameters of a =yend line
+func yencParams(line string) map[string]string {
+	params := map[string]string{}
+	for _, field := range strings.Fields(line)[1:] {
+		if kv := strings.SplitN(field, "=", 2); len(kv) == 2 {
+			params[kv[0]] = kv[1]
+		}
+	}
+	return params
+}
+
+// yencDecode decodes the lines between =ybegin and =yend, verifying the size and CRC32
+func yencDecode(encoded string) ([]byte, error) {
+	lines := strings.Split(strings.ReplaceAll(encoded, "\r\n", "\n"), "\n")
+	start := -1
+	for i, line := range lines {
+		if strings.HasPrefix(line, "=ybegin ") {
+			start = i + 1
+			break
+		}
+	}
+	if start < 0 {
+		return nil, errors.New("find =ybegin line")
+	}
+
+	var decoded []byte
+	for _, line := range lines[start:] {
+		switch {
+		case strings.HasPrefix(line, "=ypart "):
+			continue
+		case strings.HasPrefix(line, "=yend"):
+			return decoded, verifyYencTrailer(decoded, yencParams(line))
+		}
+
+		for i := 0; i < len(line); i++ {
+			c := line[i]
+			if c == '=' {
+				if i++; i == len(line) {
+					return nil, errors.New("decode escape at end of line")
+				}
+				c = line[i] - 64
+			}
+			decoded = append(decoded, c-42)
+		}
+	}
+	return nil, errors.New("find =yend line")
+}
+
+// verifyYencTrailer verifies the size and CRC32 in the =yend line
+func verifyYencTrailer(decoded []byte, params map[string]string) error {
+	if size, ok := params["size"]; ok && size != strconv.Itoa(len(decoded)) {
+		return errors.New("verify size: expected " + size + ", got " + strconv.Itoa(len(decoded)))
+	}
+
+	crc, ok := params["crc32"]
+	if !ok {
+		crc, ok = params["pcrc32"]
+	}
+	if ok {
+		expected, err := strconv.ParseUint(crc, 16, 32)
+		if err != nil {
+			return errors.Wrap(err, "parse CRC32")
+		}
+		if actual := crc32.ChecksumIEEE(decoded); uint32(expected) != actual {
+			return errors.Errorf("verify CRC32: expected %08x, got %08x", expected, actual)
+		}
+	}
+	return nil
+}
+
+func init() {
+	fmtCmd.AddCommand(NewYencCmd())
+}
@@ -3,6 +3,7 @@ module github.com/SignorMercurio/attrezzi
 go 1.16
 
 require (
+	github.com/ProtonMail/go-crypto v0.0.0-20210428141323-04723f9f07d7
 	github.com/eknkc/basex v1.0.1
 	github.com/elazarl/goproxy v0.0.0-20210801061803-8e322dfb79c4
 	github.com/golang-jwt/jwt/v4 v4.0.0
@@ -18,4 +19,7 @@ require (
 	github.com/spf13/cobra v1.2.1
 	github.com/spf13/viper v1.8.1
 	github.com/txthinking/socks5 v0.0.0-20210716140126-fa1f52a8f2da
+	golang.org/x/crypto v0.0.0-20210817164053-32db794688a5
+	golang.org/x/net v0.0.0-20210405180319-a5a99cb37ef4
+	golang.org/x/text v0.3.5
 )